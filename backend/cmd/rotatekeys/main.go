@@ -0,0 +1,60 @@
+// Command rotatekeys re-wraps every artboard data key with the current
+// master key. To rotate, generate a key with -generate, put it first in
+// STORAGE_MASTER_KEYS or the key file while keeping the old one after it,
+// restart the servers, run this command, and then drop the old key.
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+
+	"goP2Pbackend/config"
+	"goP2Pbackend/internal/repository/postgres"
+	"goP2Pbackend/internal/repository/storage"
+	"goP2Pbackend/pkg/envelope"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	generate := flag.Bool("generate", false, "print a new random master key and exit")
+	flag.Parse()
+
+	if *generate {
+		key, err := envelope.GenerateKey()
+		if err != nil {
+			log.Fatalf("Failed to generate key: %v", err)
+		}
+		fmt.Println(base64.StdEncoding.EncodeToString(key))
+		return
+	}
+
+	// The environment may be set without a .env file.
+	godotenv.Load()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	keyring, err := cfg.Storage.Keyring()
+	if err != nil {
+		log.Fatalf("Failed to load master keys: %v", err)
+	}
+	if keyring == nil {
+		log.Fatalf("No master key configured; set STORAGE_MASTER_KEYS or STORAGE_MASTER_KEY_FILE")
+	}
+
+	db, err := postgres.NewDB(cfg.GetDatabaseURL())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	rotated, err := storage.RotateKeys(postgres.NewDataKeyRepository(db), keyring)
+	if err != nil {
+		log.Fatalf("Failed after re-wrapping %d data keys: %v", rotated, err)
+	}
+	log.Printf("Re-wrapped %d data keys with master key %s", rotated, keyring.CurrentKeyID())
+}
@@ -0,0 +1,60 @@
+// Command scrub reads every stored blob of artboard data and reports those
+// that are missing, unreadable or do not match their checksum, along with
+// the artboards and versions that point at them. It exits with status 1 if
+// it found any.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"goP2Pbackend/config"
+	"goP2Pbackend/internal/repository/postgres"
+	"goP2Pbackend/internal/repository/storage"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	backfill := flag.Bool("backfill", false, "record checksums for blobs saved before checksums existed")
+	flag.Parse()
+
+	// The environment may be set without a .env file.
+	godotenv.Load()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	db, err := postgres.NewDB(cfg.GetDatabaseURL())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+	blobStore, err := storage.OpenBlobStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create blob store: %v", err)
+	}
+
+	problems := 0
+	checked, err := storage.Scrub(blobStore, postgres.NewBlobRepository(db), *backfill, func(problem *storage.ScrubProblem) {
+		problems++
+		fmt.Printf("%s\t%s", problem.Kind, problem.Blob.Hash)
+		if problem.Err != nil {
+			fmt.Printf("\t%v", problem.Err)
+		}
+		fmt.Println()
+		for _, ref := range problem.Refs {
+			fmt.Printf("\t%s\n", ref)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Scrub stopped after %d blobs: %v", checked, err)
+	}
+	log.Printf("Checked %d blobs, %d with problems", checked, problems)
+	if problems > 0 {
+		os.Exit(1)
+	}
+}
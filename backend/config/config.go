@@ -1,131 +1,402 @@
-package config
-
-import (
-	"fmt"
-	"os"
-	"strconv"
-)
-
-type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	AWS      AWSConfig
-	OAuth    OAuthConfig
-}
-
-type ServerConfig struct {
-	Port string
-	Host string
-}
-
-type DatabaseConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
-}
-
-type AWSConfig struct {
-	Region          string
-	AccessKeyID     string
-	SecretAccessKey string
-	BucketName      string
-}
-
-type OAuthConfig struct {
-	GoogleClientID     string
-	GoogleClientSecret string
-	OAuthRedirectURL   string
-}
-
-// Load reads the environment variables and returns a Config struct
-func Load() (*Config, error) {
-	// // Load .env file if it exists
-	// err := godotenv.Load()
-	// if err != nil {
-	// 	fmt.Println("Error loading the ENV file")
-	// 	panic(err)
-	// }
-
-	config := &Config{}
-
-	// Server Configuration
-	config.Server.Port = getEnv("SERVER_PORT", "8080")
-	config.Server.Host = getEnv("SERVER_HOST", "localhost")
-
-	// Database Configuration
-	config.Database.Host = getEnv("DB_HOST", "postgres")
-	config.Database.Port = getEnvAsInt("DB_PORT", 5432)
-	config.Database.User = getEnv("DB_USER", "postgres")
-	config.Database.Password = getEnv("DB_PASSWORD", "")
-	config.Database.DBName = getEnv("DB_NAME", "drawingapp")
-	config.Database.SSLMode = getEnv("DB_SSLMODE", "disable")
-
-	// AWS Configuration
-	config.AWS.Region = getEnv("AWS_REGION", "")
-	config.AWS.AccessKeyID = getEnv("AWS_ACCESS_KEY_ID", "")
-	config.AWS.SecretAccessKey = getEnv("AWS_SECRET_ACCESS_KEY", "")
-	config.AWS.BucketName = getEnv("AWS_BUCKET_NAME", "p2pdrawing")
-
-	// OAuth Configuration
-	config.OAuth.GoogleClientID = getEnv("GOOGLE_CLIENT_ID", "")
-	config.OAuth.GoogleClientSecret = getEnv("GOOGLE_CLIENT_SECRET", "")
-	config.OAuth.OAuthRedirectURL = getEnv("OAUTH_REDIRECT_URL", "http://localhost:8080/auth/google/callback")
-
-	fmt.Println(config)
-
-	// Validate required configurations
-	if err := config.validate(); err != nil {
-		return nil, err
-	}
-
-	return config, nil
-}
-
-func (c *Config) validate() error {
-	if c.OAuth.GoogleClientID == "" {
-		return fmt.Errorf("GOOGLE_CLIENT_ID is required")
-	}
-	if c.OAuth.GoogleClientSecret == "" {
-		return fmt.Errorf("GOOGLE_CLIENT_SECRET is required")
-	}
-	if c.AWS.AccessKeyID == "" {
-		return fmt.Errorf("AWS_ACCESS_KEY_ID is required")
-	}
-	if c.AWS.SecretAccessKey == "" {
-		return fmt.Errorf("AWS_SECRET_ACCESS_KEY is required")
-	}
-	return nil
-}
-
-// Helper function to read an environment variable or return a default value
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return defaultValue
-}
-
-// Helper function to read an environment variable as an integer or return a default value
-func getEnvAsInt(key string, defaultValue int) int {
-	if value, exists := os.LookupEnv(key); exists {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-	}
-	return defaultValue
-}
-
-// GetDatabaseURL returns the formatted database connection string
-func (c *Config) GetDatabaseURL() string {
-	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		c.Database.Host,
-		c.Database.Port,
-		c.Database.User,
-		c.Database.Password,
-		c.Database.DBName,
-		c.Database.SSLMode,
-	)
-}
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"goP2Pbackend/pkg/envelope"
+)
+
+type Config struct {
+	Server   ServerConfig
+	Database DatabaseConfig
+	Storage  StorageConfig
+	AWS      AWSConfig
+	OAuth    OAuthConfig
+	Auth     AuthConfig
+	WS       WebSocketConfig
+	Mail     MailConfig
+}
+
+type ServerConfig struct {
+	Port string
+	Host string
+}
+
+type DatabaseConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DBName   string
+	SSLMode  string
+}
+
+type StorageConfig struct {
+	// Driver is "s3", "fs" (local disk) or "memory" (development only).
+	Driver string
+	// Path is the root directory of the fs driver.
+	Path string
+	// Compression of stored data: "none", "gzip" or "zstd".
+	Compression string
+	// How often unreferenced data is deleted, once it has been
+	// unreferenced for GCGrace; 0 disables garbage collection.
+	GCInterval time.Duration
+	GCGrace    time.Duration
+	// Master keys for encrypting stored data, base64-encoded and separated
+	// by commas, either inline or one per line in a file. The first key is
+	// current; the others are kept until rotation has re-wrapped every data
+	// key. Without keys data is not encrypted.
+	MasterKeys    Secret
+	MasterKeyFile string
+	// MaxDataSize bounds the artboard data accepted over HTTP, in bytes.
+	MaxDataSize int64
+}
+
+// Secret is a configuration value that is never printed.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+type AWSConfig struct {
+	Region string
+	// Leave both keys empty to use the default AWS credential chain.
+	AccessKeyID     string
+	SecretAccessKey string
+	BucketName      string
+	// Endpoint, ForcePathStyle, DisableTLS and CABundle are for
+	// S3-compatible stores such as MinIO.
+	Endpoint       string
+	ForcePathStyle bool
+	DisableTLS     bool
+	CABundle       string
+	// PartSize is the size of the parts large objects are uploaded in; at
+	// least 5 MiB.
+	PartSize int64
+}
+
+type OAuthConfig struct {
+	GoogleClientID     string
+	GoogleClientSecret string
+	OAuthRedirectURL   string
+}
+
+type AuthConfig struct {
+	// TicketSecret signs the tickets that authenticate WebSocket and event
+	// stream connections; every instance needs the same one. Without it a
+	// random key is used and tickets only work on the instance that issued
+	// them.
+	TicketSecret Secret
+	// How long a ticket may be used to open a connection.
+	TicketTTL time.Duration
+}
+
+type WebSocketConfig struct {
+	WriteWait          time.Duration
+	PongWait           time.Duration
+	PingPeriod         time.Duration
+	MaxMessageSize     int64
+	ReadBufferSize     int
+	WriteBufferSize    int
+	SendBufferSize     int
+	RoomBufferSize     int
+	MaxDroppedMessages int
+	Broker             string
+	EnableCompression  bool
+	CompressionLevel   int
+	BatchMaxMessages   int
+	BatchMaxBytes      int
+	RateLimits         map[string]RateLimit
+	RoomRateLimit      RateLimit
+	MaxRateViolations  int
+	ICEServers         []string
+	MaxUndoDepth       int
+	LockTimeout        time.Duration
+	CheckpointEvery    int
+	CheckpointInterval time.Duration
+}
+
+type MailConfig struct {
+	// Driver is "log" (development) or "smtp".
+	Driver       string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword Secret
+	From         string
+	// How often unread notifications are emailed; 0 disables digests.
+	DigestInterval time.Duration
+}
+
+// RateLimit is a token bucket: Rate messages per second with bursts of up to Burst.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Load reads the environment variables and returns a Config struct
+func Load() (*Config, error) {
+	// // Load .env file if it exists
+	// err := godotenv.Load()
+	// if err != nil {
+	// 	fmt.Println("Error loading the ENV file")
+	// 	panic(err)
+	// }
+
+	config := &Config{}
+
+	// Server Configuration
+	config.Server.Port = getEnv("SERVER_PORT", "8080")
+	config.Server.Host = getEnv("SERVER_HOST", "localhost")
+
+	// Database Configuration
+	config.Database.Host = getEnv("DB_HOST", "postgres")
+	config.Database.Port = getEnvAsInt("DB_PORT", 5432)
+	config.Database.User = getEnv("DB_USER", "postgres")
+	config.Database.Password = getEnv("DB_PASSWORD", "")
+	config.Database.DBName = getEnv("DB_NAME", "drawingapp")
+	config.Database.SSLMode = getEnv("DB_SSLMODE", "disable")
+
+	// Storage Configuration
+	config.Storage.Driver = getEnv("STORAGE_DRIVER", "s3")
+	config.Storage.Path = getEnv("STORAGE_PATH", "data/artboards")
+	config.Storage.Compression = getEnv("STORAGE_COMPRESSION", "gzip")
+	config.Storage.GCInterval = getEnvAsDuration("STORAGE_GC_INTERVAL", time.Hour)
+	config.Storage.GCGrace = getEnvAsDuration("STORAGE_GC_GRACE", time.Hour)
+	config.Storage.MasterKeys = Secret(getEnv("STORAGE_MASTER_KEYS", ""))
+	config.Storage.MasterKeyFile = getEnv("STORAGE_MASTER_KEY_FILE", "")
+	config.Storage.MaxDataSize = int64(getEnvAsInt("STORAGE_MAX_DATA_SIZE", 1024*1024*1024))
+
+	// AWS Configuration
+	config.AWS.Region = getEnv("AWS_REGION", "")
+	config.AWS.AccessKeyID = getEnv("AWS_ACCESS_KEY_ID", "")
+	config.AWS.SecretAccessKey = getEnv("AWS_SECRET_ACCESS_KEY", "")
+	config.AWS.BucketName = getEnv("AWS_BUCKET_NAME", "p2pdrawing")
+	config.AWS.Endpoint = getEnv("AWS_S3_ENDPOINT", "")
+	config.AWS.ForcePathStyle = getEnvAsBool("AWS_S3_FORCE_PATH_STYLE", false)
+	config.AWS.DisableTLS = getEnvAsBool("AWS_S3_DISABLE_TLS", false)
+	config.AWS.CABundle = getEnv("AWS_S3_CA_BUNDLE", "")
+	config.AWS.PartSize = int64(getEnvAsInt("AWS_S3_PART_SIZE", 8*1024*1024))
+
+	// OAuth Configuration
+	config.OAuth.GoogleClientID = getEnv("GOOGLE_CLIENT_ID", "")
+	config.OAuth.GoogleClientSecret = getEnv("GOOGLE_CLIENT_SECRET", "")
+	config.OAuth.OAuthRedirectURL = getEnv("OAUTH_REDIRECT_URL", "http://localhost:8080/auth/google/callback")
+
+	// Auth Configuration
+	config.Auth.TicketSecret = Secret(getEnv("AUTH_TICKET_SECRET", ""))
+	config.Auth.TicketTTL = getEnvAsDuration("AUTH_TICKET_TTL", time.Minute)
+
+	// WebSocket Configuration
+	config.WS.WriteWait = getEnvAsDuration("WS_WRITE_WAIT", 10*time.Second)
+	config.WS.PongWait = getEnvAsDuration("WS_PONG_WAIT", 60*time.Second)
+	config.WS.PingPeriod = getEnvAsDuration("WS_PING_PERIOD", 54*time.Second)
+	config.WS.MaxMessageSize = int64(getEnvAsInt("WS_MAX_MESSAGE_SIZE", 64*1024))
+	config.WS.ReadBufferSize = getEnvAsInt("WS_READ_BUFFER_SIZE", 1024)
+	config.WS.WriteBufferSize = getEnvAsInt("WS_WRITE_BUFFER_SIZE", 1024)
+	config.WS.SendBufferSize = getEnvAsInt("WS_SEND_BUFFER", 256)
+	config.WS.RoomBufferSize = getEnvAsInt("WS_ROOM_BUFFER", 256)
+	config.WS.MaxDroppedMessages = getEnvAsInt("WS_MAX_DROPPED_MESSAGES", 32)
+	config.WS.Broker = getEnv("WS_BROKER", "memory")
+	config.WS.EnableCompression = getEnvAsBool("WS_ENABLE_COMPRESSION", false)
+	config.WS.CompressionLevel = getEnvAsInt("WS_COMPRESSION_LEVEL", 1)
+	config.WS.BatchMaxMessages = getEnvAsInt("WS_BATCH_MAX_MESSAGES", 1)
+	config.WS.BatchMaxBytes = getEnvAsInt("WS_BATCH_MAX_BYTES", 32*1024)
+	config.WS.RateLimits = getEnvAsRateLimits("WS_RATE_LIMITS", "cursor=60:120,ops=30:60,chat=2:5")
+	config.WS.RoomRateLimit = getEnvAsRateLimit("WS_ROOM_RATE_LIMIT", RateLimit{Rate: 500, Burst: 1000})
+	config.WS.MaxRateViolations = getEnvAsInt("WS_MAX_RATE_VIOLATIONS", 20)
+	config.WS.ICEServers = strings.Split(getEnv("WS_ICE_SERVERS", "stun:stun.l.google.com:19302"), ",")
+	config.WS.MaxUndoDepth = getEnvAsInt("WS_MAX_UNDO_DEPTH", 100)
+	config.WS.LockTimeout = getEnvAsDuration("WS_LOCK_TIMEOUT", 30*time.Second)
+	config.WS.CheckpointEvery = getEnvAsInt("WS_CHECKPOINT_EVERY", 200)
+	config.WS.CheckpointInterval = getEnvAsDuration("WS_CHECKPOINT_INTERVAL", 10*time.Minute)
+
+	// Mail Configuration
+	config.Mail.Driver = getEnv("MAIL_DRIVER", "log")
+	config.Mail.SMTPHost = getEnv("SMTP_HOST", "")
+	config.Mail.SMTPPort = getEnvAsInt("SMTP_PORT", 587)
+	config.Mail.SMTPUsername = getEnv("SMTP_USERNAME", "")
+	config.Mail.SMTPPassword = Secret(getEnv("SMTP_PASSWORD", ""))
+	config.Mail.From = getEnv("MAIL_FROM", "")
+	config.Mail.DigestInterval = getEnvAsDuration("MAIL_DIGEST_INTERVAL", 24*time.Hour)
+
+	fmt.Println(config)
+
+	// Validate required configurations
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	if c.OAuth.GoogleClientID == "" {
+		return fmt.Errorf("GOOGLE_CLIENT_ID is required")
+	}
+	if c.OAuth.GoogleClientSecret == "" {
+		return fmt.Errorf("GOOGLE_CLIENT_SECRET is required")
+	}
+	switch c.Storage.Driver {
+	case "s3":
+		if (c.AWS.AccessKeyID == "") != (c.AWS.SecretAccessKey == "") {
+			return fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set together")
+		}
+		if c.AWS.BucketName == "" {
+			return fmt.Errorf("AWS_BUCKET_NAME is required for the s3 storage driver")
+		}
+		if c.AWS.PartSize < 5*1024*1024 {
+			return fmt.Errorf("AWS_S3_PART_SIZE must be at least 5 MiB")
+		}
+	case "fs":
+		if c.Storage.Path == "" {
+			return fmt.Errorf("STORAGE_PATH is required for the fs storage driver")
+		}
+	case "memory":
+	default:
+		return fmt.Errorf("STORAGE_DRIVER must be s3, fs or memory")
+	}
+	switch c.Storage.Compression {
+	case "none", "gzip", "zstd":
+	default:
+		return fmt.Errorf("STORAGE_COMPRESSION must be none, gzip or zstd")
+	}
+	if c.Storage.MasterKeys != "" && c.Storage.MasterKeyFile != "" {
+		return fmt.Errorf("set either STORAGE_MASTER_KEYS or STORAGE_MASTER_KEY_FILE, not both")
+	}
+	if c.Storage.MaxDataSize <= 0 {
+		return fmt.Errorf("STORAGE_MAX_DATA_SIZE must be positive")
+	}
+	if c.Auth.TicketTTL <= 0 {
+		return fmt.Errorf("AUTH_TICKET_TTL must be positive")
+	}
+	if c.WS.Broker != "memory" && c.WS.Broker != "postgres" {
+		return fmt.Errorf("WS_BROKER must be memory or postgres")
+	}
+	if c.WS.PingPeriod >= c.WS.PongWait {
+		return fmt.Errorf("WS_PING_PERIOD must be less than WS_PONG_WAIT")
+	}
+	if c.WS.LockTimeout <= 0 {
+		return fmt.Errorf("WS_LOCK_TIMEOUT must be positive")
+	}
+	if c.Mail.Driver != "log" && c.Mail.Driver != "smtp" {
+		return fmt.Errorf("MAIL_DRIVER must be log or smtp")
+	}
+	if c.Mail.Driver == "smtp" && (c.Mail.SMTPHost == "" || c.Mail.From == "") {
+		return fmt.Errorf("SMTP_HOST and MAIL_FROM are required for the smtp mail driver")
+	}
+	return nil
+}
+
+// Helper function to read an environment variable or return a default value
+func getEnv(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return defaultValue
+}
+
+// Helper function to read an environment variable as an integer or return a default value
+func getEnvAsInt(key string, defaultValue int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+// Helper function to read an environment variable as a boolean or return a default value
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// Helper function to read an environment variable as a duration (e.g. "30s") or return a default value
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+// parseRateLimit reads a limit written as "rate:burst", e.g. "30:60"
+func parseRateLimit(value string) (RateLimit, error) {
+	rate, burst, ok := strings.Cut(value, ":")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+	r, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+	if err != nil {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: %w", value, err)
+	}
+	b, err := strconv.Atoi(strings.TrimSpace(burst))
+	if err != nil {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: %w", value, err)
+	}
+	return RateLimit{Rate: r, Burst: b}, nil
+}
+
+// Helper function to read an environment variable as a "rate:burst" limit or return a default value
+func getEnvAsRateLimit(key string, defaultValue RateLimit) RateLimit {
+	if value, exists := os.LookupEnv(key); exists {
+		if limit, err := parseRateLimit(value); err == nil {
+			return limit
+		}
+	}
+	return defaultValue
+}
+
+// Helper function to read an environment variable as a list of "class=rate:burst" limits or return a default value
+func getEnvAsRateLimits(key, defaultValue string) map[string]RateLimit {
+	limits := make(map[string]RateLimit)
+	for _, entry := range strings.Split(getEnv(key, defaultValue), ",") {
+		class, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		if limit, err := parseRateLimit(value); err == nil {
+			limits[strings.TrimSpace(class)] = limit
+		}
+	}
+	return limits
+}
+
+// GetDatabaseURL returns the formatted database connection string
+func (c *Config) GetDatabaseURL() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		c.Database.Host,
+		c.Database.Port,
+		c.Database.User,
+		c.Database.Password,
+		c.Database.DBName,
+		c.Database.SSLMode,
+	)
+}
+
+// Keyring returns the master keys for encrypting stored data, or nil if
+// none are configured.
+func (c *StorageConfig) Keyring() (*envelope.Keyring, error) {
+	switch {
+	case c.MasterKeyFile != "":
+		return envelope.LoadKeyFile(c.MasterKeyFile)
+	case c.MasterKeys != "":
+		return envelope.ParseKeys(string(c.MasterKeys))
+	default:
+		return nil, nil
+	}
+}
@@ -1,130 +1,189 @@
-package handler
-
-import (
-	"encoding/json"
-	"net/http"
-
-	"goP2Pbackend/internal/domain"
-
-	"github.com/gorilla/mux"
-)
-
-type ArtboardHandler struct {
-	ArtboardUsecase domain.ArtboardUsecase
-}
-
-func NewArtboardHandler(au domain.ArtboardUsecase) *ArtboardHandler {
-	return &ArtboardHandler{
-		ArtboardUsecase: au,
-	}
-}
-
-func (h *ArtboardHandler) Create(w http.ResponseWriter, r *http.Request) {
-	var artboard domain.Artboard
-	err := json.NewDecoder(r.Body).Decode(&artboard)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	// TODO: Get user ID from authenticated session
-	artboard.OwnerID = "user_id_here"
-
-	err = h.ArtboardUsecase.Create(&artboard)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(artboard)
-}
-
-func (h *ArtboardHandler) List(w http.ResponseWriter, r *http.Request) {
-	// TODO: Get user ID from authenticated session
-	userID := "user_id_here"
-
-	artboards, err := h.ArtboardUsecase.GetByOwnerID(userID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(artboards)
-}
-
-func (h *ArtboardHandler) Get(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	artboard, err := h.ArtboardUsecase.GetByID(id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(artboard)
-}
-
-func (h *ArtboardHandler) Update(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	var artboard domain.Artboard
-	err := json.NewDecoder(r.Body).Decode(&artboard)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	artboard.ID = id
-
-	err = h.ArtboardUsecase.Update(&artboard)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(artboard)
-}
-
-func (h *ArtboardHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	err := h.ArtboardUsecase.Delete(id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusNoContent)
-}
-
-func (h *ArtboardHandler) GenerateShareableLink(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	var request struct {
-		IsReadOnly bool `json:"is_read_only"`
-	}
-
-	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	link, err := h.ArtboardUsecase.GenerateShareableLink(id, request.IsReadOnly)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"link": link})
-}
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"goP2Pbackend/internal/delivery/http/middleware"
+	"goP2Pbackend/internal/domain"
+
+	"github.com/gorilla/mux"
+)
+
+type ArtboardHandler struct {
+	ArtboardUsecase domain.ArtboardUsecase
+	// MaxDataSize bounds the body of PutData, in bytes.
+	MaxDataSize int64
+}
+
+func NewArtboardHandler(au domain.ArtboardUsecase, maxDataSize int64) *ArtboardHandler {
+	return &ArtboardHandler{
+		ArtboardUsecase: au,
+		MaxDataSize:     maxDataSize,
+	}
+}
+
+func (h *ArtboardHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var artboard domain.Artboard
+	err := json.NewDecoder(r.Body).Decode(&artboard)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// TODO: Get user ID from authenticated session
+	artboard.OwnerID = "user_id_here"
+
+	err = h.ArtboardUsecase.Create(&artboard)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(artboard)
+}
+
+func (h *ArtboardHandler) List(w http.ResponseWriter, r *http.Request) {
+	// TODO: Get user ID from authenticated session
+	userID := "user_id_here"
+
+	artboards, err := h.ArtboardUsecase.GetByOwnerID(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artboards)
+}
+
+func (h *ArtboardHandler) Get(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	artboard, err := h.ArtboardUsecase.GetByID(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artboard)
+}
+
+func (h *ArtboardHandler) Update(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var artboard domain.Artboard
+	err := json.NewDecoder(r.Body).Decode(&artboard)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	artboard.ID = id
+
+	err = h.ArtboardUsecase.Update(&artboard)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artboard)
+}
+
+func (h *ArtboardHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	err := h.ArtboardUsecase.Delete(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ArtboardHandler) GenerateShareableLink(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var request struct {
+		IsReadOnly bool `json:"is_read_only"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.ArtboardUsecase.GenerateShareableLink(id, request.IsReadOnly)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"link": link})
+}
+
+// startedWriter notes whether a response body has begun, after which an
+// error can no longer be sent as a status.
+type startedWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *startedWriter) Write(p []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(p)
+}
+
+// GetData writes the artboard's document as it is now. An error partway
+// through aborts the response so that the client sees it cut short.
+func (h *ArtboardHandler) GetData(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	w.Header().Set("Content-Type", "application/json")
+	out := &startedWriter{ResponseWriter: w}
+	err := h.ArtboardUsecase.StreamArtboardData(id, user.ID, out)
+	if err == nil {
+		return
+	}
+	if !out.started {
+		writeDomainError(w, err)
+		return
+	}
+	log.Printf("Error streaming data of artboard %s: %v", id, err)
+	panic(http.ErrAbortHandler)
+}
+
+// PutData replaces the artboard's document with the request body, applied
+// to the live board as operations.
+func (h *ArtboardHandler) PutData(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	body := http.MaxBytesReader(w, r.Body, h.MaxDataSize)
+	err := h.ArtboardUsecase.ReplaceArtboardData(id, user.ID, body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "artboard data is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
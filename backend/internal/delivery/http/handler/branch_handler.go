@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"goP2Pbackend/internal/delivery/http/middleware"
+	"goP2Pbackend/internal/domain"
+
+	"github.com/gorilla/mux"
+)
+
+type BranchHandler struct {
+	BranchUsecase domain.BranchUsecase
+}
+
+func NewBranchHandler(bu domain.BranchUsecase) *BranchHandler {
+	return &BranchHandler{
+		BranchUsecase: bu,
+	}
+}
+
+func (h *BranchHandler) Fork(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	artboard, branch, err := h.BranchUsecase.Fork(id, user.ID, request.Name)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"artboard": artboard,
+		"branch":   branch,
+	})
+}
+
+func (h *BranchHandler) List(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	branches, err := h.BranchUsecase.List(id, user.ID)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(branches)
+}
+
+// Preview shows what merging the branch would change, conflicts included.
+func (h *BranchHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	result, err := h.BranchUsecase.Preview(id, user.ID)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Merge merges the branch into its parent. While conflicts remain without a
+// resolution it answers 409 Conflict listing them, and changes nothing.
+func (h *BranchHandler) Merge(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	var request struct {
+		Resolutions map[string]*domain.MergeResolution `json:"resolutions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.BranchUsecase.Merge(id, user.ID, request.Resolutions)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(result.Conflicts) > 0 {
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(result)
+}
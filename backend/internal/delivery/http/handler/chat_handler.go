@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"goP2Pbackend/internal/delivery/http/middleware"
+	"goP2Pbackend/internal/domain"
+	websocket "goP2Pbackend/pkg/ws"
+
+	"github.com/gorilla/mux"
+)
+
+// Chat message types sent over the artboard's WebSocket.
+const (
+	TypeChat       = "chat"
+	TypeChatEdit   = "chat_edit"
+	TypeChatDelete = "chat_delete"
+)
+
+const (
+	defaultChatPageSize = 50
+	maxChatPageSize     = 200
+)
+
+type ChatHandler struct {
+	ChatUsecase domain.ChatUsecase
+	Hub         *websocket.Hub
+}
+
+func NewChatHandler(cu domain.ChatUsecase, hub *websocket.Hub) *ChatHandler {
+	return &ChatHandler{
+		ChatUsecase: cu,
+		Hub:         hub,
+	}
+}
+
+// Receive posts a chat message sent over the WebSocket. The hub stamps
+// UserID with the identity the connection authenticated as; messages
+// without one are refused.
+func (h *ChatHandler) Receive(msg *websocket.Message) error {
+	if msg.UserID == "" {
+		return domain.ErrForbidden
+	}
+	var request struct {
+		Body string `json:"body"`
+	}
+	if err := json.Unmarshal(msg.Data, &request); err != nil {
+		return err
+	}
+
+	message, err := h.ChatUsecase.Post(msg.ArtboardID, msg.UserID, request.Body)
+	if err != nil {
+		return err
+	}
+	return h.broadcast(TypeChat, message, msg.From, msg.OpID)
+}
+
+func (h *ChatHandler) broadcast(messageType string, message *domain.ChatMessage, from, opID string) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return h.Hub.Broadcast(&websocket.Message{
+		Type:       messageType,
+		ArtboardID: message.ArtboardID,
+		UserID:     message.AuthorID,
+		From:       from,
+		OpID:       opID,
+		Data:       data,
+	})
+}
+
+func (h *ChatHandler) List(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	limit := defaultChatPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		if n > maxChatPageSize {
+			n = maxChatPageSize
+		}
+		limit = n
+	}
+
+	messages, err := h.ChatUsecase.List(id, user.ID, r.URL.Query().Get("before"), limit)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	unread, err := h.ChatUsecase.CountUnread(id, user.ID)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages": messages,
+		"unread":   unread,
+	})
+}
+
+func (h *ChatHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	if err := h.ChatUsecase.MarkRead(id, user.ID); err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ChatHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	vars := mux.Vars(r)
+
+	var request struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.ChatUsecase.Edit(vars["id"], vars["messageID"], user.ID, request.Body)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	if err := h.broadcast(TypeChatEdit, message, "", ""); err != nil {
+		log.Printf("Error broadcasting chat edit: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message)
+}
+
+func (h *ChatHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	vars := mux.Vars(r)
+
+	message, err := h.ChatUsecase.Delete(vars["id"], vars["messageID"], user.ID)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	if err := h.broadcast(TypeChatDelete, message, "", ""); err != nil {
+		log.Printf("Error broadcasting chat delete: %v", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeDomainError maps domain errors to status codes.
+func writeDomainError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, domain.ErrForbidden):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, domain.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"goP2Pbackend/internal/delivery/http/middleware"
+	"goP2Pbackend/internal/domain"
+	websocket "goP2Pbackend/pkg/ws"
+
+	"github.com/gorilla/mux"
+)
+
+// Comment events sent over the artboard's WebSocket. Resolving or reopening
+// a thread is an update of its first comment.
+const (
+	TypeCommentCreated = "comment_created"
+	TypeCommentUpdated = "comment_updated"
+	TypeCommentDeleted = "comment_deleted"
+)
+
+type CommentHandler struct {
+	CommentUsecase domain.CommentUsecase
+	Hub            *websocket.Hub
+}
+
+func NewCommentHandler(cu domain.CommentUsecase, hub *websocket.Hub) *CommentHandler {
+	return &CommentHandler{
+		CommentUsecase: cu,
+		Hub:            hub,
+	}
+}
+
+type commentRequest struct {
+	Body     string         `json:"body"`
+	ThreadID string         `json:"thread_id"`
+	Anchor   *domain.Anchor `json:"anchor"`
+	Mentions []string       `json:"mentions"`
+}
+
+func (h *CommentHandler) broadcast(messageType string, comment *domain.Comment, userID string) {
+	data, err := json.Marshal(comment)
+	if err != nil {
+		log.Printf("Error marshaling comment: %v", err)
+		return
+	}
+	err = h.Hub.Broadcast(&websocket.Message{Type: messageType, ArtboardID: comment.ArtboardID, UserID: userID, Data: data})
+	if err != nil {
+		log.Printf("Error broadcasting %s: %v", messageType, err)
+	}
+}
+
+func (h *CommentHandler) List(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+	includeResolved := r.URL.Query().Get("resolved") == "true"
+
+	comments, err := h.CommentUsecase.List(id, user.ID, includeResolved)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
+
+func (h *CommentHandler) Create(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	var request commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comment, err := h.CommentUsecase.Create(id, user.ID, request.ThreadID, request.Body, request.Anchor, request.Mentions)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	h.broadcast(TypeCommentCreated, comment, user.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// Reply adds a comment to the thread named in the URL.
+func (h *CommentHandler) Reply(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	vars := mux.Vars(r)
+
+	var request commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comment, err := h.CommentUsecase.Create(vars["id"], user.ID, vars["commentID"], request.Body, nil, request.Mentions)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	h.broadcast(TypeCommentCreated, comment, user.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+func (h *CommentHandler) Update(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	vars := mux.Vars(r)
+
+	var request commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comment, err := h.CommentUsecase.Edit(vars["id"], vars["commentID"], user.ID, request.Body, request.Mentions)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	h.broadcast(TypeCommentUpdated, comment, user.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+func (h *CommentHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	vars := mux.Vars(r)
+
+	comment, err := h.CommentUsecase.Delete(vars["id"], vars["commentID"], user.ID)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	h.broadcast(TypeCommentDeleted, comment, user.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CommentHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	h.setResolved(w, r, true)
+}
+
+func (h *CommentHandler) Reopen(w http.ResponseWriter, r *http.Request) {
+	h.setResolved(w, r, false)
+}
+
+func (h *CommentHandler) setResolved(w http.ResponseWriter, r *http.Request, resolved bool) {
+	user, _ := middleware.UserFromContext(r.Context())
+	vars := mux.Vars(r)
+
+	thread, err := h.CommentUsecase.SetResolved(vars["id"], vars["commentID"], user.ID, resolved)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	h.broadcast(TypeCommentUpdated, thread, user.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(thread)
+}
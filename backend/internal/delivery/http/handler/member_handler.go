@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"goP2Pbackend/internal/delivery/http/middleware"
+	"goP2Pbackend/internal/domain"
+
+	"github.com/gorilla/mux"
+)
+
+type MemberHandler struct {
+	MemberUsecase domain.MemberUsecase
+}
+
+func NewMemberHandler(mu domain.MemberUsecase) *MemberHandler {
+	return &MemberHandler{
+		MemberUsecase: mu,
+	}
+}
+
+func (h *MemberHandler) List(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	members, err := h.MemberUsecase.List(id, user.ID)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+func (h *MemberHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	vars := mux.Vars(r)
+
+	var request struct {
+		Role domain.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.MemberUsecase.SetRole(vars["id"], user.ID, vars["userID"], request.Role); err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *MemberHandler) Remove(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	vars := mux.Vars(r)
+
+	if err := h.MemberUsecase.Remove(vars["id"], user.ID, vars["userID"]); err != nil {
+		writeDomainError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Join lets the user in through the artboard's share link.
+func (h *MemberHandler) Join(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	var request struct {
+		ShareableID string `json:"shareable_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	role, err := h.MemberUsecase.JoinByLink(id, request.ShareableID, user.ID)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]domain.Role{"role": role})
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"goP2Pbackend/internal/delivery/http/middleware"
+	"goP2Pbackend/internal/domain"
+)
+
+const (
+	defaultNotificationPageSize = 50
+	maxNotificationPageSize     = 200
+)
+
+type NotificationHandler struct {
+	NotificationUsecase domain.NotificationUsecase
+}
+
+func NewNotificationHandler(nu domain.NotificationUsecase) *NotificationHandler {
+	return &NotificationHandler{
+		NotificationUsecase: nu,
+	}
+}
+
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	query := r.URL.Query()
+
+	limit := defaultNotificationPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		if n > maxNotificationPageSize {
+			n = maxNotificationPageSize
+		}
+		limit = n
+	}
+
+	notifications, err := h.NotificationUsecase.List(user.ID, query.Get("unread") == "true", query.Get("before"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	unread, err := h.NotificationUsecase.CountUnread(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifications,
+		"unread":        unread,
+	})
+}
+
+// MarkRead marks the listed notifications as read, or all of them if the
+// list is empty.
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+
+	var request struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.NotificationUsecase.MarkRead(user.ID, request.IDs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
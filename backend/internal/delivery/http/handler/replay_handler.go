@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"goP2Pbackend/internal/delivery/http/middleware"
+	"goP2Pbackend/internal/domain"
+
+	"github.com/gorilla/mux"
+)
+
+type ReplayHandler struct {
+	ReplayUsecase domain.ReplayUsecase
+}
+
+func NewReplayHandler(ru domain.ReplayUsecase) *ReplayHandler {
+	return &ReplayHandler{
+		ReplayUsecase: ru,
+	}
+}
+
+// Replay streams a time-lapse of the board as server-sent events: a
+// snapshot as of ?from= (a sequence number, default 0), each operation up
+// to ?to= (default the latest), then end. ?speed= accelerates playback
+// (default 1, real time). Browsers' EventSource cannot send headers, so
+// it takes a ticket from /auth/ticket as ?ticket= instead.
+func (h *ReplayHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	var fromSeq, toSeq int64
+	speed := 1.0
+	var err error
+	if v := query.Get("from"); v != "" {
+		if fromSeq, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if toSeq, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("speed"); v != "" {
+		if speed, err = strconv.ParseFloat(v, 64); err != nil {
+			http.Error(w, "invalid speed", http.StatusBadRequest)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	started := false
+	send := func(frame *domain.ReplayFrame) error {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			started = true
+		}
+		data, err := json.Marshal(frame)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", frame.Event, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	err = h.ReplayUsecase.Replay(r.Context(), id, user.ID, fromSeq, toSeq, speed, send)
+	switch {
+	case err == nil, r.Context().Err() != nil:
+	case !started:
+		writeDomainError(w, err)
+	default:
+		log.Printf("Error replaying %s: %v", id, err)
+		fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+		flusher.Flush()
+	}
+}
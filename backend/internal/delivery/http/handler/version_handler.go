@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"goP2Pbackend/internal/delivery/http/middleware"
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/board"
+
+	"github.com/gorilla/mux"
+)
+
+type VersionHandler struct {
+	VersionUsecase domain.VersionUsecase
+}
+
+func NewVersionHandler(vu domain.VersionUsecase) *VersionHandler {
+	return &VersionHandler{
+		VersionUsecase: vu,
+	}
+}
+
+func (h *VersionHandler) List(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	versions, err := h.VersionUsecase.List(id, user.ID)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+func (h *VersionHandler) Create(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	version, err := h.VersionUsecase.Create(id, user.ID, request.Name)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(version)
+}
+
+// Get returns a version together with its document.
+func (h *VersionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	vars := mux.Vars(r)
+
+	version, data, err := h.VersionUsecase.Load(vars["id"], vars["versionID"], user.ID)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": version,
+		"data":    json.RawMessage(data),
+	})
+}
+
+func (h *VersionHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	vars := mux.Vars(r)
+
+	version, err := h.VersionUsecase.Restore(vars["id"], vars["versionID"], user.ID)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(version)
+}
+
+// Diff compares two versions given as ?from= and ?to=, where "head" (the
+// default for to) is the board as it is now. With ?format=svg it returns an
+// overlay highlighting the changed objects instead of the JSON diff.
+func (h *VersionHandler) Diff(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.UserFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	diff, err := h.VersionUsecase.Diff(id, query.Get("from"), query.Get("to"), user.ID)
+	if err != nil {
+		writeDomainError(w, err)
+		return
+	}
+
+	switch query.Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(diff)
+	case "svg":
+		highlights := make([]board.Highlight, 0, len(diff.Added)+len(diff.Removed)+2*len(diff.Modified))
+		for _, object := range diff.Removed {
+			highlights = append(highlights, board.Highlight{Kind: board.HighlightRemoved, Object: object})
+		}
+		for _, change := range diff.Modified {
+			highlights = append(highlights,
+				board.Highlight{Kind: board.HighlightPrevious, Object: change.Before},
+				board.Highlight{Kind: board.HighlightModified, Object: change.After})
+		}
+		for _, object := range diff.Added {
+			highlights = append(highlights, board.Highlight{Kind: board.HighlightAdded, Object: object})
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(board.Overlay(highlights))
+	default:
+		http.Error(w, "format must be json or svg", http.StatusBadRequest)
+	}
+}
@@ -1,39 +1,78 @@
-package middleware
-
-import (
-	"context"
-	"goP2Pbackend/internal/domain"
-	"net/http"
-	"strings"
-)
-
-func AuthMiddleware(userUsecase domain.UserUsecase) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Missing authorization header", http.StatusUnauthorized)
-				return
-			}
-
-			bearerToken := strings.Split(authHeader, " ")
-			if len(bearerToken) != 2 {
-				http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
-				return
-			}
-
-			token := bearerToken[1]
-
-			// TODO: Implement proper token validation
-			// This is a placeholder implementation
-			user, err := userUsecase.GetByID(token)
-			if err != nil {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
-				return
-			}
-
-			ctx := context.WithValue(r.Context(), "user", user)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	}
-}
+package middleware
+
+import (
+	"context"
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/auth"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func AuthMiddleware(userUsecase domain.UserUsecase) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				http.Error(w, "Missing authorization header", http.StatusUnauthorized)
+				return
+			}
+
+			bearerToken := strings.Split(authHeader, " ")
+			if len(bearerToken) != 2 {
+				http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
+				return
+			}
+
+			token := bearerToken[1]
+
+			// TODO: Implement proper token validation
+			// This is a placeholder implementation
+			user, err := userUsecase.GetByID(token)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "user", user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// TicketMiddleware authenticates like AuthMiddleware, or with a ticket in
+// the "ticket" query parameter for clients that cannot set headers, such as
+// a browser's WebSocket or EventSource.
+func TicketMiddleware(userUsecase domain.UserUsecase, tickets *auth.Tickets) func(http.Handler) http.Handler {
+	byHeader := AuthMiddleware(userUsecase)
+	return func(next http.Handler) http.Handler {
+		withHeader := byHeader(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ticket := r.URL.Query().Get("ticket")
+			if ticket == "" {
+				withHeader.ServeHTTP(w, r)
+				return
+			}
+
+			userID, err := tickets.Verify(ticket, time.Now())
+			if err != nil {
+				http.Error(w, "Invalid ticket", http.StatusUnauthorized)
+				return
+			}
+			user, err := userUsecase.GetByID(userID)
+			if err != nil {
+				http.Error(w, "Invalid ticket", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "user", user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// UserFromContext returns the user stored by AuthMiddleware.
+func UserFromContext(ctx context.Context) (*domain.User, bool) {
+	user, ok := ctx.Value("user").(*domain.User)
+	return user, ok
+}
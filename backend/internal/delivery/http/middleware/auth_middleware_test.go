@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/auth"
+	websocket "goP2Pbackend/pkg/ws"
+
+	"github.com/gorilla/mux"
+	gorilla "github.com/gorilla/websocket"
+)
+
+type fakeUsers map[string]*domain.User
+
+func (f fakeUsers) Create(user *domain.User) error { return nil }
+
+func (f fakeUsers) GetByID(id string) (*domain.User, error) {
+	if user, ok := f[id]; ok {
+		return user, nil
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (f fakeUsers) GetByEmail(email string) (*domain.User, error) { return nil, domain.ErrNotFound }
+func (f fakeUsers) Update(user *domain.User) error                { return nil }
+
+// newServer serves a hub's WebSocket endpoint behind TicketMiddleware, the
+// way main.go does.
+func newServer(t *testing.T, tickets *auth.Tickets) *httptest.Server {
+	hub := websocket.NewHub(websocket.DefaultConfig(), websocket.NewMemoryBroker(), nil)
+	users := fakeUsers{"alice": {ID: "alice"}}
+
+	router := mux.NewRouter()
+	router.Handle("/ws/{artboardID}", TicketMiddleware(users, tickets)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		websocket.ServeWs(hub, user.ID, w, r)
+	})))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTicketOpensWebSocket(t *testing.T) {
+	tickets := auth.NewTickets([]byte("test key"), time.Minute)
+	server := newServer(t, tickets)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/board"
+
+	ticket, _ := tickets.Issue("alice", time.Now())
+	conn, _, err := gorilla.DefaultDialer.Dial(url+"?ticket="+ticket, nil)
+	if err != nil {
+		t.Fatalf("dial with a ticket: %v", err)
+	}
+	defer conn.Close()
+
+	var welcome websocket.Message
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&welcome); err != nil {
+		t.Fatal(err)
+	}
+	if welcome.Type != "welcome" || welcome.UserID != "alice" {
+		t.Fatalf("got %s for %q, want welcome for alice", welcome.Type, welcome.UserID)
+	}
+}
+
+func TestTicketsAreChecked(t *testing.T) {
+	tickets := auth.NewTickets([]byte("test key"), time.Minute)
+	server := newServer(t, tickets)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/board"
+
+	expired, _ := tickets.Issue("alice", time.Now().Add(-2*time.Minute))
+	forged, _ := auth.NewTickets([]byte("other key"), time.Minute).Issue("alice", time.Now())
+	unknown, _ := tickets.Issue("mallory", time.Now())
+	for name, query := range map[string]string{
+		"no ticket":    "",
+		"expired":      "?ticket=" + expired,
+		"forged":       "?ticket=" + forged,
+		"unknown user": "?ticket=" + unknown,
+		"garbage":      "?ticket=not-a-ticket",
+	} {
+		_, resp, err := gorilla.DefaultDialer.Dial(url+query, nil)
+		if err == nil {
+			t.Fatalf("%s: connected", name)
+		}
+		if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("%s: got %v, want 401", name, resp)
+		}
+	}
+}
@@ -1,37 +1,55 @@
-package domain
-
-import "time"
-
-type Artboard struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	OwnerID     string    `json:"owner_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	ShareableID string    `json:"shareable_id"`
-	IsReadOnly  bool      `json:"is_read_only"`
-}
-
-type ArtboardRepository interface {
-	Create(artboard *Artboard) error
-	GetByID(id string) (*Artboard, error)
-	GetByOwnerID(ownerID string) ([]*Artboard, error)
-	Update(artboard *Artboard) error
-	Delete(id string) error
-}
-
-type ArtboardStorage interface {
-	Save(artboardID string, data []byte) error
-	Load(artboardID string) ([]byte, error)
-}
-
-type ArtboardUsecase interface {
-	Create(artboard *Artboard) error
-	GetByID(id string) (*Artboard, error)
-	GetByOwnerID(ownerID string) ([]*Artboard, error)
-	Update(artboard *Artboard) error
-	Delete(id string) error
-	GenerateShareableLink(artboardID string, isReadOnly bool) (string, error)
-	SaveArtboardData(artboardID string, data []byte) error
-	LoadArtboardData(artboardID string) ([]byte, error)
-}
+package domain
+
+import (
+	"io"
+	"time"
+)
+
+type Artboard struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	OwnerID     string    `json:"owner_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	ShareableID string    `json:"shareable_id"`
+	IsReadOnly  bool      `json:"is_read_only"`
+}
+
+type ArtboardRepository interface {
+	Create(artboard *Artboard) error
+	GetByID(id string) (*Artboard, error)
+	GetByOwnerID(ownerID string) ([]*Artboard, error)
+	Update(artboard *Artboard) error
+	Delete(id string) error
+}
+
+type ArtboardStorage interface {
+	Save(artboardID string, data []byte) error
+	Load(artboardID string) ([]byte, error)
+	// SaveVersion and LoadVersion keep the documents of version history
+	// apart from the artboard's current data.
+	SaveVersion(artboardID, versionID string, data []byte) error
+	LoadVersion(artboardID, versionID string) ([]byte, error)
+	// SaveFrom and LoadTo stream an artboard's data for boards too large
+	// to hold in memory. LoadTo may fail after writing part of the data,
+	// including when it turns out to be corrupt.
+	SaveFrom(artboardID string, r io.Reader) error
+	LoadTo(artboardID string, w io.Writer) error
+	// Delete lets go of an artboard's data and all of its versions.
+	Delete(artboardID string) error
+}
+
+type ArtboardUsecase interface {
+	Create(artboard *Artboard) error
+	GetByID(id string) (*Artboard, error)
+	GetByOwnerID(ownerID string) ([]*Artboard, error)
+	Update(artboard *Artboard) error
+	Delete(id string) error
+	GenerateShareableLink(artboardID string, isReadOnly bool) (string, error)
+	SaveArtboardData(artboardID string, data []byte) error
+	LoadArtboardData(artboardID string) ([]byte, error)
+	// StreamArtboardData and ReplaceArtboardData read and replace the live
+	// board for a user, who must be able to edit it to replace it.
+	StreamArtboardData(artboardID, userID string, w io.Writer) error
+	ReplaceArtboardData(artboardID, userID string, r io.Reader) error
+}
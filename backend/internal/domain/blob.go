@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"io"
+	"time"
+)
+
+// BlobStore keeps opaque data by key. It is the backend under
+// ArtboardStorage: S3, local disk or memory.
+type BlobStore interface {
+	// Put stores what r reads under key, without holding it all in
+	// memory. contentEncoding names the compression of the data, if any,
+	// for backends that record it.
+	Put(key string, r io.Reader, contentEncoding string) error
+	// Get opens the data under key for reading, or fails with
+	// ErrNotFound. The caller closes it.
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// Blob is a piece of stored data addressed by the SHA-256 hash of its
+// content, so that identical snapshots are stored once. RefCount is the
+// number of storage keys, such as an artboard or one of its versions, that
+// point at it. An encrypted blob names the artboard whose DataKey it is
+// encrypted with in KeyID; its hash is then keyed as well. Checksum is the
+// SHA-256 of the bytes as stored, compressed and encrypted, so it can be
+// checked without any keys. Segmented blobs are encrypted in segments that
+// can be decrypted as they are read; older encrypted blobs are sealed whole.
+type Blob struct {
+	Hash       string    `json:"hash"`
+	Encoding   string    `json:"encoding"`
+	KeyID      string    `json:"key_id,omitempty"`
+	Checksum   string    `json:"checksum,omitempty"`
+	Segmented  bool      `json:"segmented,omitempty"`
+	Size       int64     `json:"size"`
+	StoredSize int64     `json:"stored_size"`
+	RefCount   int       `json:"ref_count"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type BlobRepository interface {
+	// Create records a stored blob with no references, unless it is
+	// already recorded.
+	Create(blob *Blob) error
+	// Ref points key at the blob with the given hash, moving the reference
+	// from whichever blob it pointed at before. It fails with ErrNotFound
+	// if the blob is not recorded.
+	Ref(key, hash string) error
+	// Get returns a blob by hash, or ErrNotFound.
+	Get(hash string) (*Blob, error)
+	// Resolve returns the blob key points at, or ErrNotFound.
+	Resolve(key string) (*Blob, error)
+	// List returns blobs ordered by hash, starting after afterHash.
+	List(afterHash string, limit int) ([]*Blob, error)
+	// ListRefs returns the keys pointing at a blob.
+	ListRefs(hash string) ([]string, error)
+	// Unref removes key and every key below it, such as key + "/x",
+	// dropping the references they held.
+	Unref(key string) error
+	// UpdateStored records the checksum, stored size and segmenting of a
+	// blob whose data was written again.
+	UpdateStored(blob *Blob) error
+	// ListUnreferenced returns the hashes of blobs that have had no
+	// references since before the given time.
+	ListUnreferenced(before time.Time, limit int) ([]string, error)
+	// Delete forgets a blob if it is still unreferenced and reports
+	// whether it did. remove deletes the data itself and runs before the
+	// record is gone, so that saving the same content meanwhile waits for
+	// it instead of pointing at deleted data.
+	Delete(hash string, remove func() error) (bool, error)
+}
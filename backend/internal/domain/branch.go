@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Branch is an artboard forked from another one, its parent, to be edited
+// independently and merged back. BaseVersionID is the version both last had
+// in common: the parent at the fork, then the branch as of its last merge.
+type Branch struct {
+	ArtboardID    string     `json:"artboard_id"`
+	ParentID      string     `json:"parent_id"`
+	BaseVersionID string     `json:"base_version_id"`
+	CreatedBy     string     `json:"created_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	MergedAt      *time.Time `json:"merged_at,omitempty"`
+}
+
+type BranchRepository interface {
+	Create(branch *Branch) error
+	// GetByArtboard returns the branch record of an artboard, or
+	// ErrNotFound if it is not a branch.
+	GetByArtboard(artboardID string) (*Branch, error)
+	ListByParent(parentID string) ([]*Branch, error)
+	Update(branch *Branch) error
+}
+
+// Ways to resolve a merge conflict.
+const (
+	TakeParent = "parent"
+	TakeBranch = "branch"
+)
+
+// MergeResolution settles one conflicting object: Take picks the parent's
+// or the branch's side, deleting the object if that side deleted it, or
+// Object replaces it outright.
+type MergeResolution struct {
+	Take   string          `json:"take,omitempty"`
+	Object json.RawMessage `json:"object,omitempty"`
+}
+
+// MergeConflict is an object the parent and the branch changed differently
+// since their common version.
+type MergeConflict struct {
+	ID     string          `json:"id"`
+	Base   json.RawMessage `json:"base"`
+	Parent json.RawMessage `json:"parent"`
+	Branch json.RawMessage `json:"branch"`
+}
+
+// MergeResult describes a merge. Unless Conflicts is empty nothing was
+// changed, and the merge must be repeated with a resolution for each.
+type MergeResult struct {
+	Added     []string         `json:"added"`
+	Removed   []string         `json:"removed"`
+	Modified  []string         `json:"modified"`
+	Conflicts []*MergeConflict `json:"conflicts"`
+	// Version is the parent's version recording a completed merge.
+	Version *Version `json:"version,omitempty"`
+}
+
+type BranchUsecase interface {
+	// Fork copies an artboard as it is now into a new branch owned by
+	// userID.
+	Fork(artboardID, userID, name string) (*Artboard, *Branch, error)
+	List(artboardID, userID string) ([]*Branch, error)
+	// Preview reports what merging a branch into its parent would change
+	// without changing anything.
+	Preview(branchID, userID string) (*MergeResult, error)
+	// Merge applies a branch's changes to its parent. Resolutions are
+	// keyed by object ID.
+	Merge(branchID, userID string, resolutions map[string]*MergeResolution) (*MergeResult, error)
+}
@@ -0,0 +1,40 @@
+package domain
+
+import "time"
+
+// ChatMessage is a message in an artboard's chat. Deleted messages keep
+// their row, without a body, so pagination cursors stay valid.
+type ChatMessage struct {
+	ID         string     `json:"id"`
+	ArtboardID string     `json:"artboard_id"`
+	AuthorID   string     `json:"author_id"`
+	Body       string     `json:"body"`
+	CreatedAt  time.Time  `json:"created_at"`
+	EditedAt   *time.Time `json:"edited_at,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+}
+
+type ChatRepository interface {
+	Create(message *ChatMessage) error
+	GetByID(id string) (*ChatMessage, error)
+	Update(message *ChatMessage) error
+	// ListByArtboard returns up to limit live messages older than the
+	// message before (or the newest ones if before is empty), newest first.
+	ListByArtboard(artboardID, before string, limit int) ([]*ChatMessage, error)
+	MarkRead(artboardID, userID string, at time.Time) error
+	// CountUnread counts other users' messages posted since userID last
+	// read the artboard's chat.
+	CountUnread(artboardID, userID string) (int, error)
+}
+
+type ChatUsecase interface {
+	Post(artboardID, authorID, body string) (*ChatMessage, error)
+	// Edit and Delete only touch userID's own messages on artboardID.
+	Edit(artboardID, id, userID, body string) (*ChatMessage, error)
+	Delete(artboardID, id, userID string) (*ChatMessage, error)
+	// Every method fails with ErrForbidden for users who cannot see the
+	// artboard.
+	List(artboardID, userID, before string, limit int) ([]*ChatMessage, error)
+	MarkRead(artboardID, userID string) error
+	CountUnread(artboardID, userID string) (int, error)
+}
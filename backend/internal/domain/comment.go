@@ -0,0 +1,55 @@
+package domain
+
+import "time"
+
+// Anchor pins a comment thread to a point on the board or to an object.
+type Anchor struct {
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	ObjectID string  `json:"object_id,omitempty"`
+}
+
+// Comment is either the first comment of a thread, which carries the anchor
+// and resolved state, or a reply in it. A thread's ID is the ID of its
+// first comment.
+type Comment struct {
+	ID         string     `json:"id"`
+	ArtboardID string     `json:"artboard_id"`
+	ThreadID   string     `json:"thread_id"`
+	AuthorID   string     `json:"author_id"`
+	Body       string     `json:"body"`
+	Anchor     *Anchor    `json:"anchor,omitempty"`
+	Mentions   []string   `json:"mentions,omitempty"`
+	Resolved   bool       `json:"resolved"`
+	ResolvedBy string     `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	EditedAt   *time.Time `json:"edited_at,omitempty"`
+}
+
+// IsThread reports whether the comment starts a thread.
+func (c *Comment) IsThread() bool {
+	return c.ID == c.ThreadID
+}
+
+type CommentRepository interface {
+	Create(comment *Comment) error
+	GetByID(id string) (*Comment, error)
+	Update(comment *Comment) error
+	// Delete removes a comment, and its replies if it starts a thread.
+	Delete(id string) error
+	// ListByArtboard returns every comment on the artboard in creation
+	// order, leaving out resolved threads unless includeResolved is set.
+	ListByArtboard(artboardID string, includeResolved bool) ([]*Comment, error)
+	// ListByThread returns a thread's comments in creation order.
+	ListByThread(threadID string) ([]*Comment, error)
+}
+
+type CommentUsecase interface {
+	// Create starts a thread at anchor, or replies to threadID if it is set.
+	Create(artboardID, authorID, threadID, body string, anchor *Anchor, mentions []string) (*Comment, error)
+	Edit(artboardID, id, userID, body string, mentions []string) (*Comment, error)
+	Delete(artboardID, id, userID string) (*Comment, error)
+	SetResolved(artboardID, threadID, userID string, resolved bool) (*Comment, error)
+	List(artboardID, userID string, includeResolved bool) ([]*Comment, error)
+}
@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// DataKey is the key an artboard's stored data is encrypted with, itself
+// encrypted ("wrapped") with a master key from the configuration.
+type DataKey struct {
+	ArtboardID  string     `json:"artboard_id"`
+	WrappedKey  []byte     `json:"-"`
+	MasterKeyID string     `json:"master_key_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RotatedAt   *time.Time `json:"rotated_at,omitempty"`
+}
+
+type DataKeyRepository interface {
+	// Create records a data key unless the artboard already has one.
+	Create(key *DataKey) error
+	// Get returns an artboard's data key, or ErrNotFound.
+	Get(artboardID string) (*DataKey, error)
+	// ListWrappedWithout returns data keys wrapped with any master key but
+	// masterKeyID.
+	ListWrappedWithout(masterKeyID string, limit int) ([]*DataKey, error)
+	// Rewrap replaces a data key's wrapping, provided it is still wrapped
+	// with previousMasterKeyID.
+	Rewrap(key *DataKey, previousMasterKeyID string) error
+}
@@ -0,0 +1,10 @@
+package domain
+
+import "errors"
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrForbidden = errors.New("forbidden")
+	ErrInvalid   = errors.New("invalid input")
+	ErrCorrupt   = errors.New("stored data is corrupted")
+)
@@ -0,0 +1,72 @@
+package domain
+
+// Role is what a user may do on an artboard. The artboard's owner always
+// has RoleOwner and members get the role they were given. Users who joined
+// through the current share link are editors, or viewers if the artboard is
+// shared read-only. Nobody else, including removed members, has any access.
+type Role string
+
+const (
+	RoleOwner     Role = "owner"
+	RoleEditor    Role = "editor"
+	RoleCommenter Role = "commenter"
+	RoleViewer    Role = "viewer"
+	// RoleRemoved is recorded for members the owner removed, so that they
+	// cannot join again through the link. It is never returned by
+	// MemberUsecase.Role.
+	RoleRemoved Role = "removed"
+	// RoleLinked is recorded for users who joined through a share link.
+	// MemberUsecase.Role turns it into the link's role while the link is
+	// current.
+	RoleLinked Role = "linked"
+)
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleOwner, RoleEditor, RoleCommenter, RoleViewer:
+		return true
+	}
+	return false
+}
+
+// CanEdit reports whether the role may draw on the board.
+func (r Role) CanEdit() bool {
+	return r == RoleOwner || r == RoleEditor
+}
+
+// CanComment reports whether the role may write comments.
+func (r Role) CanComment() bool {
+	return r.CanEdit() || r == RoleCommenter
+}
+
+type Member struct {
+	ArtboardID string `json:"artboard_id"`
+	UserID     string `json:"user_id"`
+	Role       Role   `json:"role"`
+	// ShareableID is the link a RoleLinked user joined through.
+	ShareableID string `json:"-"`
+}
+
+type MemberRepository interface {
+	// Get returns ErrNotFound if the user has no role on the artboard.
+	Get(artboardID, userID string) (*Member, error)
+	SetRole(member *Member) error
+	// ListByArtboard leaves out removed and linked users.
+	ListByArtboard(artboardID string) ([]*Member, error)
+}
+
+type MemberUsecase interface {
+	// Role fails with ErrForbidden for users without access.
+	Role(artboardID, userID string) (Role, error)
+	// JoinByLink lets userID in through the artboard's share link and
+	// returns the role they now have. Links replaced since fail with
+	// ErrForbidden, and so do removed members.
+	JoinByLink(artboardID, shareableID, userID string) (Role, error)
+	// IsMember reports whether userID owns the artboard or was given a role
+	// on it, as opposed to merely having its link.
+	IsMember(artboardID, userID string) (bool, error)
+	// SetRole and Remove may only be called by the artboard's owner.
+	SetRole(artboardID, actorID, userID string, role Role) error
+	Remove(artboardID, actorID, userID string) error
+	List(artboardID, actorID string) ([]*Member, error)
+}
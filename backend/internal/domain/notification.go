@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Notification kinds.
+const (
+	NotificationMention      = "mention"
+	NotificationCommentReply = "comment_reply"
+	NotificationInvitation   = "invitation"
+	NotificationShare        = "share"
+)
+
+// Notification is an entry in a user's notification center. Data is the
+// payload of the event, e.g. the comment that mentioned the user.
+type Notification struct {
+	ID        string          `json:"id"`
+	UserID    string          `json:"user_id"`
+	Kind      string          `json:"kind"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+	EmailedAt *time.Time      `json:"-"`
+}
+
+type NotificationRepository interface {
+	Create(notification *Notification) error
+	// ListByUser returns up to limit notifications older than the
+	// notification before (or the newest ones if before is empty), newest
+	// first.
+	ListByUser(userID string, unreadOnly bool, before string, limit int) ([]*Notification, error)
+	CountUnread(userID string) (int, error)
+	// MarkRead marks the given notifications of userID as read, or all of
+	// them if ids is empty.
+	MarkRead(userID string, ids []string, at time.Time) error
+	// ListUndigestedUsers returns up to limit users, in ID order after the
+	// user after, with unread notifications created before before that
+	// have not been emailed yet.
+	ListUndigestedUsers(after string, before time.Time, limit int) ([]string, error)
+	// ClaimUndigested marks up to limit of userID's unread notifications
+	// created before before that have not been emailed yet as emailed at
+	// at, and returns them oldest first. Concurrent claims never return
+	// the same notification.
+	ClaimUndigested(userID string, before time.Time, limit int, at time.Time) ([]*Notification, error)
+	// UnclaimEmailed makes notifications claimed for a digest that was not
+	// sent undigested again.
+	UnclaimEmailed(ids []string) error
+}
+
+type NotificationUsecase interface {
+	Notifier
+	List(userID string, unreadOnly bool, before string, limit int) ([]*Notification, error)
+	CountUnread(userID string) (int, error)
+	MarkRead(userID string, ids []string) error
+	// SendDigests emails every user who is not online a summary of their
+	// unread notifications created before before that have not been
+	// emailed yet. Users it fails to email are tried again next time.
+	// Instances may run it at the same time; each notification is emailed
+	// once.
+	SendDigests(before time.Time) error
+}
+
+// Mailer sends plain-text email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
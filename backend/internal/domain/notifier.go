@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// Notifier tells a user about something that happened, e.g. that they were
+// mentioned in a comment.
+type Notifier interface {
+	Notify(userID, kind string, data interface{}) error
+}
+
+// Presence tells whether a user is connected right now to any instance,
+// e.g. over a WebSocket, and so sees notifications as they happen.
+type Presence interface {
+	IsOnline(userID string) (bool, error)
+}
+
+// PresenceRepository shares the users each instance has connected.
+type PresenceRepository interface {
+	Presence
+	// Touch records userIDs as connected to instanceID as of at, and
+	// forgets the instance's other users.
+	Touch(instanceID string, userIDs []string, at time.Time) error
+}
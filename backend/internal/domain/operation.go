@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Operation is one sequenced mutation in an artboard's operation log.
+type Operation struct {
+	ArtboardID string          `json:"artboard_id"`
+	Seq        int64           `json:"seq"`
+	OpID       string          `json:"op_id"`
+	UserID     string          `json:"user_id"`
+	Type       string          `json:"type"`
+	ObjectID   string          `json:"object_id"`
+	Data       json.RawMessage `json:"data"`
+	Prev       json.RawMessage `json:"prev,omitempty"`
+	UndoOf     int64           `json:"undo_of,omitempty"`
+	RedoOf     int64           `json:"redo_of,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type OperationRepository interface {
+	Append(op *Operation) error
+	// ListByArtboard returns operations with fromSeq < seq <= toSeq in
+	// sequence order. A toSeq of 0 means no upper bound.
+	ListByArtboard(artboardID string, fromSeq, toSeq int64) ([]*Operation, error)
+	// ListPage is ListByArtboard returning at most limit operations.
+	ListPage(artboardID string, fromSeq, toSeq int64, limit int) ([]*Operation, error)
+}
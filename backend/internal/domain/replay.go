@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ReplayFrame is one step of a replay, handed to the caller's send
+// function: the board as of the starting point, then each operation in
+// turn, then the end.
+type ReplayFrame struct {
+	Event     string          `json:"-"`
+	Seq       int64           `json:"seq"`
+	Objects   json.RawMessage `json:"objects,omitempty"`
+	Operation *Operation      `json:"operation,omitempty"`
+}
+
+// Replay frame events.
+const (
+	ReplaySnapshot  = "snapshot"
+	ReplayOperation = "operation"
+	ReplayEnd       = "end"
+)
+
+type ReplayUsecase interface {
+	// Replay plays back the operations after fromSeq up to toSeq (0 for
+	// the latest) from the operation log, spaced as they happened divided
+	// by speed. It stops when ctx is done or send fails.
+	Replay(ctx context.Context, artboardID, userID string, fromSeq, toSeq int64, speed float64, send func(frame *ReplayFrame) error) error
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// VersionHead names the board as it is now wherever a version ID is
+// expected in a diff.
+const VersionHead = "head"
+
+// Version is a saved state of an artboard as of an operation sequence
+// number. Automatic checkpoints have no name. The document itself is kept
+// in ArtboardStorage under the version's ID.
+type Version struct {
+	ID           string    `json:"id"`
+	ArtboardID   string    `json:"artboard_id"`
+	Seq          int64     `json:"seq"`
+	Name         string    `json:"name,omitempty"`
+	CreatedBy    string    `json:"created_by,omitempty"`
+	RestoredFrom string    `json:"restored_from,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ObjectChange is an object as it was in both snapshots of a diff.
+type ObjectChange struct {
+	ID     string          `json:"id"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// VersionDiff is what changed on a board from one snapshot to another.
+type VersionDiff struct {
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Added    []json.RawMessage `json:"added"`
+	Removed  []json.RawMessage `json:"removed"`
+	Modified []*ObjectChange   `json:"modified"`
+}
+
+type VersionRepository interface {
+	Create(version *Version) error
+	GetByID(id string) (*Version, error)
+	// ListByArtboard returns the artboard's versions, newest first.
+	ListByArtboard(artboardID string) ([]*Version, error)
+	// Latest returns the version with the highest sequence number, or
+	// ErrNotFound if there is none.
+	Latest(artboardID string) (*Version, error)
+	// LatestAt returns the version with the highest sequence number at or
+	// below seq, or ErrNotFound if there is none.
+	LatestAt(artboardID string, seq int64) (*Version, error)
+}
+
+// OperationSubmitter changes a live board on behalf of the server, such as
+// to restore a version. The board's room computes the operations against
+// the board as it is, so nothing anyone did meanwhile is lost, and applies,
+// logs and relays them like a client's.
+type OperationSubmitter interface {
+	// Patch makes the changes that turn the document from into to, or
+	// turns the whole board into to if from is nil. Either every operation
+	// applies or none does. It returns the board after the change and its
+	// sequence number.
+	Patch(artboardID, userID string, from, to []byte) ([]byte, int64, error)
+}
+
+type VersionUsecase interface {
+	// Checkpoint saves an automatic version of a document as of seq.
+	Checkpoint(artboardID string, seq int64, data []byte) (*Version, error)
+	// Latest returns the most recent version of a board and its document,
+	// or ErrNotFound if there is none. Like Checkpoint, it is for the
+	// server's own use and checks no role.
+	Latest(artboardID string) (*Version, []byte, error)
+	// Create saves a named version of the board as it is now.
+	Create(artboardID, userID, name string) (*Version, error)
+	List(artboardID, userID string) ([]*Version, error)
+	// Load returns a version and its document.
+	Load(artboardID, versionID, userID string) (*Version, []byte, error)
+	// Restore brings the board back to a version and records the result as
+	// a new version.
+	Restore(artboardID, versionID, userID string) (*Version, error)
+	// Diff compares two versions; either may be VersionHead.
+	Diff(artboardID, fromID, toID, userID string) (*VersionDiff, error)
+}
@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"goP2Pbackend/internal/domain"
+)
+
+type blobStore struct {
+	mutex sync.RWMutex
+	blobs map[string][]byte
+}
+
+// NewBlobStore keeps blobs in process memory. It is meant for development
+// and tests: everything is lost on restart and instances do not share it.
+func NewBlobStore() domain.BlobStore {
+	return &blobStore{blobs: make(map[string][]byte)}
+}
+
+func (s *blobStore) Put(key string, r io.Reader, contentEncoding string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.blobs[key] = data
+	return nil
+}
+
+// Get reads from the data as it was when opened; stored data is never
+// modified in place.
+func (s *blobStore) Get(key string) (io.ReadCloser, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *blobStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
@@ -0,0 +1,196 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+)
+
+type blobRepository struct {
+	db *sql.DB
+}
+
+func NewBlobRepository(db *sql.DB) domain.BlobRepository {
+	return &blobRepository{db: db}
+}
+
+func (r *blobRepository) Create(blob *domain.Blob) error {
+	query := `INSERT INTO storage_blobs (hash, encoding, key_id, checksum, segmented, size, stored_size, ref_count, created_at, unreferenced_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, 0, $8, $8) ON CONFLICT (hash) DO NOTHING`
+	_, err := r.db.Exec(query, blob.Hash, blob.Encoding, nullableString(blob.KeyID), nullableString(blob.Checksum),
+		blob.Segmented, blob.Size, blob.StoredSize, blob.CreatedAt)
+	return err
+}
+
+func (r *blobRepository) Ref(key, hash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serialize changes to the same key, including its first one.
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, key); err != nil {
+		return err
+	}
+	var previous sql.NullString
+	err = tx.QueryRow(`SELECT hash FROM storage_refs WHERE key = $1`, key).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if previous.String == hash {
+		return tx.Commit()
+	}
+
+	now := time.Now()
+	result, err := tx.Exec(`UPDATE storage_blobs SET ref_count = ref_count + 1, unreferenced_at = NULL WHERE hash = $1`, hash)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return domain.ErrNotFound
+	}
+
+	query := `INSERT INTO storage_refs (key, hash, updated_at) VALUES ($1, $2, $3)
+              ON CONFLICT (key) DO UPDATE SET hash = EXCLUDED.hash, updated_at = EXCLUDED.updated_at`
+	if _, err := tx.Exec(query, key, hash, now); err != nil {
+		return err
+	}
+	if previous.Valid {
+		query := `UPDATE storage_blobs SET ref_count = ref_count - 1,
+                  unreferenced_at = CASE WHEN ref_count = 1 THEN $2 ELSE unreferenced_at END
+                  WHERE hash = $1`
+		if _, err := tx.Exec(query, previous.String, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const blobColumns = `b.hash, b.encoding, b.key_id, b.checksum, b.segmented, b.size, b.stored_size, b.ref_count, b.created_at`
+
+func scanBlob(row interface{ Scan(...interface{}) error }) (*domain.Blob, error) {
+	var blob domain.Blob
+	var keyID, checksum sql.NullString
+	err := row.Scan(&blob.Hash, &blob.Encoding, &keyID, &checksum, &blob.Segmented, &blob.Size, &blob.StoredSize, &blob.RefCount, &blob.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	blob.KeyID = keyID.String
+	blob.Checksum = checksum.String
+	return &blob, nil
+}
+
+func (r *blobRepository) Get(hash string) (*domain.Blob, error) {
+	query := `SELECT ` + blobColumns + ` FROM storage_blobs b WHERE b.hash = $1`
+	return scanBlob(r.db.QueryRow(query, hash))
+}
+
+func (r *blobRepository) Resolve(key string) (*domain.Blob, error) {
+	query := `SELECT ` + blobColumns + ` FROM storage_refs r JOIN storage_blobs b ON b.hash = r.hash WHERE r.key = $1`
+	return scanBlob(r.db.QueryRow(query, key))
+}
+
+func (r *blobRepository) List(afterHash string, limit int) ([]*domain.Blob, error) {
+	query := `SELECT ` + blobColumns + ` FROM storage_blobs b WHERE b.hash > $1 ORDER BY b.hash LIMIT $2`
+	rows, err := r.db.Query(query, afterHash, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blobs []*domain.Blob
+	for rows.Next() {
+		blob, err := scanBlob(rows)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+	return blobs, rows.Err()
+}
+
+func (r *blobRepository) ListRefs(hash string) ([]string, error) {
+	rows, err := r.db.Query(`SELECT key FROM storage_refs WHERE hash = $1 ORDER BY key`, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *blobRepository) Unref(key string) error {
+	below := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(key) + "/%"
+	query := `WITH gone AS (
+                  DELETE FROM storage_refs WHERE key = $1 OR key LIKE $2 RETURNING hash
+              ), counts AS (
+                  SELECT hash, COUNT(*) AS n FROM gone GROUP BY hash
+              )
+              UPDATE storage_blobs b SET ref_count = b.ref_count - c.n,
+                  unreferenced_at = CASE WHEN b.ref_count = c.n THEN $3 ELSE b.unreferenced_at END
+              FROM counts c WHERE b.hash = c.hash`
+	_, err := r.db.Exec(query, key, below, time.Now())
+	return err
+}
+
+func (r *blobRepository) UpdateStored(blob *domain.Blob) error {
+	query := `UPDATE storage_blobs SET checksum = $2, stored_size = $3, segmented = $4 WHERE hash = $1`
+	_, err := r.db.Exec(query, blob.Hash, nullableString(blob.Checksum), blob.StoredSize, blob.Segmented)
+	return err
+}
+
+func (r *blobRepository) ListUnreferenced(before time.Time, limit int) ([]string, error) {
+	query := `SELECT hash FROM storage_blobs WHERE ref_count = 0 AND unreferenced_at < $1 ORDER BY unreferenced_at LIMIT $2`
+	rows, err := r.db.Query(query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+func (r *blobRepository) Delete(hash string, remove func() error) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM storage_blobs WHERE hash = $1 AND ref_count = 0`, hash)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if err := remove(); err != nil {
+		return false, fmt.Errorf("failed to remove blob %s: %w", hash, err)
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"goP2Pbackend/internal/domain"
+)
+
+type branchRepository struct {
+	db *sql.DB
+}
+
+func NewBranchRepository(db *sql.DB) domain.BranchRepository {
+	return &branchRepository{db: db}
+}
+
+const branchColumns = `artboard_id, parent_id, base_version_id, created_by, created_at, merged_at`
+
+func scanBranch(row interface{ Scan(...interface{}) error }) (*domain.Branch, error) {
+	var branch domain.Branch
+	var mergedAt sql.NullTime
+	err := row.Scan(&branch.ArtboardID, &branch.ParentID, &branch.BaseVersionID, &branch.CreatedBy, &branch.CreatedAt, &mergedAt)
+	if err != nil {
+		return nil, err
+	}
+	if mergedAt.Valid {
+		branch.MergedAt = &mergedAt.Time
+	}
+	return &branch, nil
+}
+
+func (r *branchRepository) Create(branch *domain.Branch) error {
+	query := `INSERT INTO artboard_branches (artboard_id, parent_id, base_version_id, created_by, created_at, merged_at)
+              VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := r.db.Exec(query, branch.ArtboardID, branch.ParentID, branch.BaseVersionID, branch.CreatedBy, branch.CreatedAt, branch.MergedAt)
+	return err
+}
+
+func (r *branchRepository) GetByArtboard(artboardID string) (*domain.Branch, error) {
+	query := `SELECT ` + branchColumns + ` FROM artboard_branches WHERE artboard_id = $1`
+	branch, err := scanBranch(r.db.QueryRow(query, artboardID))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	return branch, err
+}
+
+func (r *branchRepository) ListByParent(parentID string) ([]*domain.Branch, error) {
+	query := `SELECT ` + branchColumns + ` FROM artboard_branches WHERE parent_id = $1 ORDER BY created_at`
+	rows, err := r.db.Query(query, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var branches []*domain.Branch
+	for rows.Next() {
+		branch, err := scanBranch(rows)
+		if err != nil {
+			return nil, err
+		}
+		branches = append(branches, branch)
+	}
+	return branches, rows.Err()
+}
+
+func (r *branchRepository) Update(branch *domain.Branch) error {
+	query := `UPDATE artboard_branches SET base_version_id = $2, merged_at = $3 WHERE artboard_id = $1`
+	_, err := r.db.Exec(query, branch.ArtboardID, branch.BaseVersionID, branch.MergedAt)
+	return err
+}
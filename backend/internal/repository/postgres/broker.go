@@ -0,0 +1,247 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	websocket "goP2Pbackend/pkg/ws"
+
+	"github.com/lib/pq"
+)
+
+const (
+	brokerChannel = "gop2p_rooms"
+	// NOTIFY payloads must stay under 8000 bytes; notifications larger than
+	// this, as sent, carry a reference into the ws_broker_messages table
+	// instead.
+	maxNotifyPayload = 7000
+	// How long parked payloads are kept for slow listeners.
+	brokerRetention = 5 * time.Minute
+	// How many payloads may wait for one subscriber before it is told to
+	// resync instead.
+	maxSubscriptionQueue = 1024
+)
+
+type notification struct {
+	ArtboardID string `json:"a"`
+	Payload    string `json:"p,omitempty"`
+	Ref        int64  `json:"r,omitempty"`
+}
+
+type broker struct {
+	db          *sql.DB
+	listener    *pq.Listener
+	mutex       sync.Mutex
+	subscribers map[string]map[int]*subscription
+	nextID      int
+}
+
+// subscription hands payloads to one subscriber in order on a goroutine of
+// its own, so a busy room never holds up the listener or other rooms.
+type subscription struct {
+	deliver func([]byte)
+	mutex   sync.Mutex
+	queue   [][]byte
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+func newSubscription(deliver func([]byte)) *subscription {
+	s := &subscription{
+		deliver: deliver,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// push queues a payload without blocking. A subscriber that falls too far
+// behind loses what is queued and gets a nil payload in its place, like
+// after a reconnect.
+func (s *subscription) push(payload []byte) {
+	s.mutex.Lock()
+	if len(s.queue) >= maxSubscriptionQueue {
+		for i := range s.queue {
+			s.queue[i] = nil
+		}
+		s.queue = s.queue[:1]
+		log.Printf("Broker subscriber fell %d payloads behind; resyncing", maxSubscriptionQueue)
+	} else {
+		s.queue = append(s.queue, payload)
+	}
+	s.mutex.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) run() {
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+		for {
+			s.mutex.Lock()
+			if len(s.queue) == 0 {
+				s.mutex.Unlock()
+				break
+			}
+			payload := s.queue[0]
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+			s.mutex.Unlock()
+			s.deliver(payload)
+		}
+	}
+}
+
+// NewBroker returns a websocket.Broker backed by Postgres LISTEN/NOTIFY.
+// Every instance listens on one channel and dispatches by artboard ID.
+func NewBroker(db *sql.DB, databaseURL string) (websocket.Broker, error) {
+	listener := pq.NewListener(databaseURL, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Broker listener error: %v", err)
+		}
+	})
+	if err := listener.Listen(brokerChannel); err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", brokerChannel, err)
+	}
+
+	b := &broker{
+		db:          db,
+		listener:    listener,
+		subscribers: make(map[string]map[int]*subscription),
+	}
+	go b.dispatch()
+	return b, nil
+}
+
+func (b *broker) Publish(artboardID string, payload []byte) error {
+	// The payload is escaped as a JSON string, which can make it several
+	// times larger, so the limit applies to what is actually sent.
+	body, err := json.Marshal(notification{ArtboardID: artboardID, Payload: string(payload)})
+	if err != nil {
+		return err
+	}
+	if len(body) > maxNotifyPayload {
+		n := notification{ArtboardID: artboardID}
+		query := `INSERT INTO ws_broker_messages (artboard_id, payload) VALUES ($1, $2) RETURNING id`
+		if err := b.db.QueryRow(query, artboardID, string(payload)).Scan(&n.Ref); err != nil {
+			return fmt.Errorf("failed to store broker payload: %w", err)
+		}
+		if body, err = json.Marshal(n); err != nil {
+			return err
+		}
+	}
+
+	_, err = b.db.Exec(`SELECT pg_notify($1, $2)`, brokerChannel, string(body))
+	return err
+}
+
+func (b *broker) Subscribe(artboardID string, deliver func([]byte)) (func(), error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.subscribers[artboardID]; !ok {
+		b.subscribers[artboardID] = make(map[int]*subscription)
+	}
+	id := b.nextID
+	b.nextID++
+	sub := newSubscription(deliver)
+	b.subscribers[artboardID][id] = sub
+
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if _, ok := b.subscribers[artboardID][id]; !ok {
+			return
+		}
+		close(sub.done)
+		delete(b.subscribers[artboardID], id)
+		if len(b.subscribers[artboardID]) == 0 {
+			delete(b.subscribers, artboardID)
+		}
+	}, nil
+}
+
+func (b *broker) NextSeq(artboardID string) (int64, error) {
+	query := `INSERT INTO artboard_sequences (artboard_id, seq) VALUES ($1, 1)
+              ON CONFLICT (artboard_id) DO UPDATE SET seq = artboard_sequences.seq + 1
+              RETURNING seq`
+	var seq int64
+	err := b.db.QueryRow(query, artboardID).Scan(&seq)
+	return seq, err
+}
+
+func (b *broker) dispatch() {
+	cleanup := time.NewTicker(brokerRetention)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case n := <-b.listener.Notify:
+			// A nil notification means the connection was re-established;
+			// whatever was sent meanwhile is lost.
+			if n == nil {
+				b.resync()
+				continue
+			}
+			b.handle(n.Extra)
+		case <-cleanup.C:
+			query := `DELETE FROM ws_broker_messages WHERE created_at < $1`
+			if _, err := b.db.Exec(query, time.Now().Add(-brokerRetention)); err != nil {
+				log.Printf("Error cleaning up broker messages: %v", err)
+			}
+		}
+	}
+}
+
+// resync tells every subscriber that payloads may have been lost.
+func (b *broker) resync() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, subs := range b.subscribers {
+		for _, sub := range subs {
+			sub.push(nil)
+		}
+	}
+}
+
+func (b *broker) handle(extra string) {
+	var n notification
+	if err := json.Unmarshal([]byte(extra), &n); err != nil {
+		log.Printf("Error unmarshaling notification: %v", err)
+		return
+	}
+
+	b.mutex.Lock()
+	subs := make([]*subscription, 0, len(b.subscribers[n.ArtboardID]))
+	for _, sub := range b.subscribers[n.ArtboardID] {
+		subs = append(subs, sub)
+	}
+	b.mutex.Unlock()
+	if len(subs) == 0 {
+		return
+	}
+
+	payload := n.Payload
+	if n.Ref != 0 {
+		query := `SELECT payload FROM ws_broker_messages WHERE id = $1`
+		if err := b.db.QueryRow(query, n.Ref).Scan(&payload); err != nil {
+			log.Printf("Error loading broker payload %d: %v", n.Ref, err)
+			return
+		}
+	}
+
+	for _, sub := range subs {
+		sub.push([]byte(payload))
+	}
+}
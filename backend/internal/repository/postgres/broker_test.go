@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscriptionFallsBackToResync(t *testing.T) {
+	release := make(chan struct{})
+	delivered := make(chan []byte, maxSubscriptionQueue+10)
+	sub := newSubscription(func(payload []byte) {
+		<-release
+		delivered <- payload
+	})
+	defer close(sub.done)
+
+	// The first payload is taken off the queue and held by deliver.
+	sub.push([]byte("first"))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sub.mutex.Lock()
+		empty := len(sub.queue) == 0
+		sub.mutex.Unlock()
+		if empty {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("first payload was never delivered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < maxSubscriptionQueue+1; i++ {
+		sub.push([]byte("later"))
+	}
+	sub.push([]byte("after"))
+	sub.mutex.Lock()
+	queued := len(sub.queue)
+	sub.mutex.Unlock()
+	if queued != 2 {
+		t.Fatalf("%d payloads queued after overflowing, want a resync and the next", queued)
+	}
+
+	close(release)
+	for _, want := range []string{"first", "", "after"} {
+		select {
+		case payload := <-delivered:
+			if string(payload) != want || (want == "") != (payload == nil) {
+				t.Fatalf("delivered %q, want %q", payload, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("waiting for %q", want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+)
+
+type chatRepository struct {
+	db *sql.DB
+}
+
+func NewChatRepository(db *sql.DB) domain.ChatRepository {
+	return &chatRepository{db: db}
+}
+
+const chatColumns = `id, artboard_id, author_id, body, created_at, edited_at, deleted_at`
+
+func scanChatMessage(row interface{ Scan(...interface{}) error }) (*domain.ChatMessage, error) {
+	var message domain.ChatMessage
+	var editedAt, deletedAt sql.NullTime
+	err := row.Scan(&message.ID, &message.ArtboardID, &message.AuthorID, &message.Body, &message.CreatedAt, &editedAt, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	if editedAt.Valid {
+		message.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		message.DeletedAt = &deletedAt.Time
+	}
+	return &message, nil
+}
+
+func (r *chatRepository) Create(message *domain.ChatMessage) error {
+	query := `INSERT INTO chat_messages (id, artboard_id, author_id, body, created_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.db.Exec(query, message.ID, message.ArtboardID, message.AuthorID, message.Body, message.CreatedAt)
+	return err
+}
+
+func (r *chatRepository) GetByID(id string) (*domain.ChatMessage, error) {
+	query := `SELECT ` + chatColumns + ` FROM chat_messages WHERE id = $1`
+	message, err := scanChatMessage(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	return message, err
+}
+
+func (r *chatRepository) Update(message *domain.ChatMessage) error {
+	query := `UPDATE chat_messages SET body = $2, edited_at = $3, deleted_at = $4 WHERE id = $1`
+	_, err := r.db.Exec(query, message.ID, message.Body, message.EditedAt, message.DeletedAt)
+	return err
+}
+
+func (r *chatRepository) ListByArtboard(artboardID, before string, limit int) ([]*domain.ChatMessage, error) {
+	query := `SELECT ` + chatColumns + ` FROM chat_messages
+              WHERE artboard_id = $1 AND deleted_at IS NULL
+                AND ($2 = '' OR (created_at, id) < (SELECT created_at, id FROM chat_messages WHERE id = $2))
+              ORDER BY created_at DESC, id DESC LIMIT $3`
+	rows, err := r.db.Query(query, artboardID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*domain.ChatMessage
+	for rows.Next() {
+		message, err := scanChatMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+func (r *chatRepository) MarkRead(artboardID, userID string, at time.Time) error {
+	query := `INSERT INTO chat_reads (artboard_id, user_id, last_read_at) VALUES ($1, $2, $3)
+              ON CONFLICT (artboard_id, user_id) DO UPDATE SET last_read_at = GREATEST(chat_reads.last_read_at, EXCLUDED.last_read_at)`
+	_, err := r.db.Exec(query, artboardID, userID, at)
+	return err
+}
+
+func (r *chatRepository) CountUnread(artboardID, userID string) (int, error) {
+	query := `SELECT COUNT(*) FROM chat_messages m
+              LEFT JOIN chat_reads r ON r.artboard_id = m.artboard_id AND r.user_id = $2
+              WHERE m.artboard_id = $1 AND m.author_id <> $2 AND m.deleted_at IS NULL
+                AND (r.last_read_at IS NULL OR m.created_at > r.last_read_at)`
+	var count int
+	err := r.db.QueryRow(query, artboardID, userID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"goP2Pbackend/internal/domain"
+)
+
+type commentRepository struct {
+	db *sql.DB
+}
+
+func NewCommentRepository(db *sql.DB) domain.CommentRepository {
+	return &commentRepository{db: db}
+}
+
+const commentColumns = `id, artboard_id, thread_id, author_id, body, anchor, mentions, resolved, resolved_by, resolved_at, created_at, edited_at`
+
+func scanComment(row interface{ Scan(...interface{}) error }) (*domain.Comment, error) {
+	var comment domain.Comment
+	var anchor, mentions []byte
+	var resolvedBy sql.NullString
+	var resolvedAt, editedAt sql.NullTime
+	err := row.Scan(&comment.ID, &comment.ArtboardID, &comment.ThreadID, &comment.AuthorID, &comment.Body, &anchor, &mentions,
+		&comment.Resolved, &resolvedBy, &resolvedAt, &comment.CreatedAt, &editedAt)
+	if err != nil {
+		return nil, err
+	}
+	if len(anchor) > 0 {
+		if err := json.Unmarshal(anchor, &comment.Anchor); err != nil {
+			return nil, err
+		}
+	}
+	if len(mentions) > 0 {
+		if err := json.Unmarshal(mentions, &comment.Mentions); err != nil {
+			return nil, err
+		}
+	}
+	comment.ResolvedBy = resolvedBy.String
+	if resolvedAt.Valid {
+		comment.ResolvedAt = &resolvedAt.Time
+	}
+	if editedAt.Valid {
+		comment.EditedAt = &editedAt.Time
+	}
+	return &comment, nil
+}
+
+func marshalNullable(v interface{}, empty bool) (interface{}, error) {
+	if empty {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func (r *commentRepository) Create(comment *domain.Comment) error {
+	anchor, err := marshalNullable(comment.Anchor, comment.Anchor == nil)
+	if err != nil {
+		return err
+	}
+	mentions, err := marshalNullable(comment.Mentions, len(comment.Mentions) == 0)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO comments (id, artboard_id, thread_id, author_id, body, anchor, mentions, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = r.db.Exec(query, comment.ID, comment.ArtboardID, comment.ThreadID, comment.AuthorID, comment.Body, anchor, mentions, comment.CreatedAt)
+	return err
+}
+
+func (r *commentRepository) GetByID(id string) (*domain.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE id = $1`
+	comment, err := scanComment(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	return comment, err
+}
+
+func (r *commentRepository) Update(comment *domain.Comment) error {
+	mentions, err := marshalNullable(comment.Mentions, len(comment.Mentions) == 0)
+	if err != nil {
+		return err
+	}
+	var resolvedBy interface{}
+	if comment.ResolvedBy != "" {
+		resolvedBy = comment.ResolvedBy
+	}
+	query := `UPDATE comments SET body = $2, mentions = $3, resolved = $4, resolved_by = $5, resolved_at = $6, edited_at = $7 WHERE id = $1`
+	_, err = r.db.Exec(query, comment.ID, comment.Body, mentions, comment.Resolved, resolvedBy, comment.ResolvedAt, comment.EditedAt)
+	return err
+}
+
+func (r *commentRepository) Delete(id string) error {
+	query := `DELETE FROM comments WHERE id = $1 OR thread_id = $1`
+	_, err := r.db.Exec(query, id)
+	return err
+}
+
+func (r *commentRepository) ListByArtboard(artboardID string, includeResolved bool) ([]*domain.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments
+              WHERE artboard_id = $1
+                AND ($2 OR thread_id NOT IN (SELECT id FROM comments WHERE artboard_id = $1 AND resolved))
+              ORDER BY created_at, id`
+	return r.query(query, artboardID, includeResolved)
+}
+
+func (r *commentRepository) ListByThread(threadID string) ([]*domain.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE thread_id = $1 ORDER BY created_at, id`
+	return r.query(query, threadID)
+}
+
+func (r *commentRepository) query(query string, args ...interface{}) ([]*domain.Comment, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*domain.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
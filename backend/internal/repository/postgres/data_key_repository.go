@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"goP2Pbackend/internal/domain"
+)
+
+type dataKeyRepository struct {
+	db *sql.DB
+}
+
+func NewDataKeyRepository(db *sql.DB) domain.DataKeyRepository {
+	return &dataKeyRepository{db: db}
+}
+
+const dataKeyColumns = `artboard_id, wrapped_key, master_key_id, created_at, rotated_at`
+
+func scanDataKey(row interface{ Scan(...interface{}) error }) (*domain.DataKey, error) {
+	var key domain.DataKey
+	var rotatedAt sql.NullTime
+	err := row.Scan(&key.ArtboardID, &key.WrappedKey, &key.MasterKeyID, &key.CreatedAt, &rotatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if rotatedAt.Valid {
+		key.RotatedAt = &rotatedAt.Time
+	}
+	return &key, nil
+}
+
+func (r *dataKeyRepository) Create(key *domain.DataKey) error {
+	query := `INSERT INTO artboard_keys (artboard_id, wrapped_key, master_key_id, created_at)
+              VALUES ($1, $2, $3, $4) ON CONFLICT (artboard_id) DO NOTHING`
+	_, err := r.db.Exec(query, key.ArtboardID, key.WrappedKey, key.MasterKeyID, key.CreatedAt)
+	return err
+}
+
+func (r *dataKeyRepository) Get(artboardID string) (*domain.DataKey, error) {
+	query := `SELECT ` + dataKeyColumns + ` FROM artboard_keys WHERE artboard_id = $1`
+	key, err := scanDataKey(r.db.QueryRow(query, artboardID))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	return key, err
+}
+
+func (r *dataKeyRepository) ListWrappedWithout(masterKeyID string, limit int) ([]*domain.DataKey, error) {
+	query := `SELECT ` + dataKeyColumns + ` FROM artboard_keys WHERE master_key_id <> $1 ORDER BY artboard_id LIMIT $2`
+	rows, err := r.db.Query(query, masterKeyID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*domain.DataKey
+	for rows.Next() {
+		key, err := scanDataKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *dataKeyRepository) Rewrap(key *domain.DataKey, previousMasterKeyID string) error {
+	query := `UPDATE artboard_keys SET wrapped_key = $2, master_key_id = $3, rotated_at = $4
+              WHERE artboard_id = $1 AND master_key_id = $5`
+	_, err := r.db.Exec(query, key.ArtboardID, key.WrappedKey, key.MasterKeyID, key.RotatedAt, previousMasterKeyID)
+	return err
+}
@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"goP2Pbackend/internal/domain"
+)
+
+type memberRepository struct {
+	db *sql.DB
+}
+
+func NewMemberRepository(db *sql.DB) domain.MemberRepository {
+	return &memberRepository{db: db}
+}
+
+func (r *memberRepository) Get(artboardID, userID string) (*domain.Member, error) {
+	query := `SELECT artboard_id, user_id, role, shareable_id FROM artboard_members WHERE artboard_id = $1 AND user_id = $2`
+	var member domain.Member
+	err := r.db.QueryRow(query, artboardID, userID).Scan(&member.ArtboardID, &member.UserID, &member.Role, &member.ShareableID)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *memberRepository) SetRole(member *domain.Member) error {
+	query := `INSERT INTO artboard_members (artboard_id, user_id, role, shareable_id) VALUES ($1, $2, $3, $4)
+              ON CONFLICT (artboard_id, user_id) DO UPDATE SET role = EXCLUDED.role, shareable_id = EXCLUDED.shareable_id`
+	_, err := r.db.Exec(query, member.ArtboardID, member.UserID, member.Role, member.ShareableID)
+	return err
+}
+
+func (r *memberRepository) ListByArtboard(artboardID string) ([]*domain.Member, error) {
+	query := `SELECT artboard_id, user_id, role FROM artboard_members WHERE artboard_id = $1 AND role NOT IN ($2, $3) ORDER BY user_id`
+	rows, err := r.db.Query(query, artboardID, domain.RoleRemoved, domain.RoleLinked)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*domain.Member
+	for rows.Next() {
+		var member domain.Member
+		if err := rows.Scan(&member.ArtboardID, &member.UserID, &member.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+	return members, rows.Err()
+}
@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+
+	"github.com/lib/pq"
+)
+
+type notificationRepository struct {
+	db *sql.DB
+}
+
+func NewNotificationRepository(db *sql.DB) domain.NotificationRepository {
+	return &notificationRepository{db: db}
+}
+
+const notificationColumns = `id, user_id, kind, data, created_at, read_at, emailed_at`
+
+func scanNotification(row interface{ Scan(...interface{}) error }) (*domain.Notification, error) {
+	var notification domain.Notification
+	var data []byte
+	var readAt, emailedAt sql.NullTime
+	err := row.Scan(&notification.ID, &notification.UserID, &notification.Kind, &data, &notification.CreatedAt, &readAt, &emailedAt)
+	if err != nil {
+		return nil, err
+	}
+	notification.Data = data
+	if readAt.Valid {
+		notification.ReadAt = &readAt.Time
+	}
+	if emailedAt.Valid {
+		notification.EmailedAt = &emailedAt.Time
+	}
+	return &notification, nil
+}
+
+func (r *notificationRepository) query(query string, args ...interface{}) ([]*domain.Notification, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []*domain.Notification
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func (r *notificationRepository) Create(notification *domain.Notification) error {
+	query := `INSERT INTO notifications (id, user_id, kind, data, created_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.db.Exec(query, notification.ID, notification.UserID, notification.Kind, []byte(notification.Data), notification.CreatedAt)
+	return err
+}
+
+func (r *notificationRepository) ListByUser(userID string, unreadOnly bool, before string, limit int) ([]*domain.Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications
+              WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+                AND ($3 = '' OR (created_at, id) < (SELECT created_at, id FROM notifications WHERE id = $3))
+              ORDER BY created_at DESC, id DESC LIMIT $4`
+	return r.query(query, userID, unreadOnly, before, limit)
+}
+
+func (r *notificationRepository) CountUnread(userID string) (int, error) {
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`
+	var count int
+	err := r.db.QueryRow(query, userID).Scan(&count)
+	return count, err
+}
+
+func (r *notificationRepository) MarkRead(userID string, ids []string, at time.Time) error {
+	query := `UPDATE notifications SET read_at = $3
+              WHERE user_id = $1 AND read_at IS NULL AND (cardinality($2::text[]) = 0 OR id = ANY($2))`
+	_, err := r.db.Exec(query, userID, pq.Array(ids), at)
+	return err
+}
+
+func (r *notificationRepository) ListUndigestedUsers(after string, before time.Time, limit int) ([]string, error) {
+	query := `SELECT DISTINCT user_id FROM notifications
+              WHERE read_at IS NULL AND emailed_at IS NULL AND created_at < $2 AND user_id > $1
+              ORDER BY user_id LIMIT $3`
+	rows, err := r.db.Query(query, after, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		users = append(users, userID)
+	}
+	return users, rows.Err()
+}
+
+func (r *notificationRepository) ClaimUndigested(userID string, before time.Time, limit int, at time.Time) ([]*domain.Notification, error) {
+	query := `UPDATE notifications SET emailed_at = $4 WHERE id IN (
+                  SELECT id FROM notifications
+                  WHERE user_id = $1 AND read_at IS NULL AND emailed_at IS NULL AND created_at < $2
+                  ORDER BY created_at LIMIT $3 FOR UPDATE SKIP LOCKED
+              ) RETURNING ` + notificationColumns
+	notifications, err := r.query(query, userID, before, limit, at)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.Before(notifications[j].CreatedAt)
+	})
+	return notifications, nil
+}
+
+func (r *notificationRepository) UnclaimEmailed(ids []string) error {
+	query := `UPDATE notifications SET emailed_at = NULL WHERE id = ANY($1)`
+	_, err := r.db.Exec(query, pq.Array(ids))
+	return err
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"database/sql"
+	"goP2Pbackend/internal/domain"
+)
+
+type operationRepository struct {
+	db *sql.DB
+}
+
+func NewOperationRepository(db *sql.DB) domain.OperationRepository {
+	return &operationRepository{db: db}
+}
+
+func (r *operationRepository) Append(op *domain.Operation) error {
+	query := `INSERT INTO artboard_operations (artboard_id, seq, op_id, user_id, type, object_id, data, prev, undo_of, redo_of, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	_, err := r.db.Exec(query, op.ArtboardID, op.Seq, op.OpID, op.UserID, op.Type, op.ObjectID, []byte(op.Data), nullableJSON(op.Prev), nullableSeq(op.UndoOf), nullableSeq(op.RedoOf), op.CreatedAt)
+	return err
+}
+
+func (r *operationRepository) ListByArtboard(artboardID string, fromSeq, toSeq int64) ([]*domain.Operation, error) {
+	query := `SELECT artboard_id, seq, op_id, user_id, type, object_id, data, prev, undo_of, redo_of, created_at
+              FROM artboard_operations WHERE artboard_id = $1 AND seq > $2 AND ($3 = 0 OR seq <= $3) ORDER BY seq`
+	return r.list(query, artboardID, fromSeq, toSeq)
+}
+
+func (r *operationRepository) ListPage(artboardID string, fromSeq, toSeq int64, limit int) ([]*domain.Operation, error) {
+	query := `SELECT artboard_id, seq, op_id, user_id, type, object_id, data, prev, undo_of, redo_of, created_at
+              FROM artboard_operations WHERE artboard_id = $1 AND seq > $2 AND ($3 = 0 OR seq <= $3) ORDER BY seq LIMIT $4`
+	return r.list(query, artboardID, fromSeq, toSeq, limit)
+}
+
+func (r *operationRepository) list(query string, args ...interface{}) ([]*domain.Operation, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ops []*domain.Operation
+	for rows.Next() {
+		var op domain.Operation
+		var data, prev []byte
+		var undoOf, redoOf sql.NullInt64
+		err := rows.Scan(&op.ArtboardID, &op.Seq, &op.OpID, &op.UserID, &op.Type, &op.ObjectID, &data, &prev, &undoOf, &redoOf, &op.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		op.Data = data
+		op.Prev = prev
+		op.UndoOf = undoOf.Int64
+		op.RedoOf = redoOf.Int64
+		ops = append(ops, &op)
+	}
+	return ops, rows.Err()
+}
+
+func nullableJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
+
+func nullableSeq(seq int64) interface{} {
+	if seq == 0 {
+		return nil
+	}
+	return seq
+}
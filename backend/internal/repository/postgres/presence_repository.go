@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+
+	"github.com/lib/pq"
+)
+
+type presenceRepository struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+// NewPresenceRepository keeps the users connected to each instance. A user
+// counts as online while some instance has reported them within ttl, so
+// that instances which stop reporting drop out on their own.
+func NewPresenceRepository(db *sql.DB, ttl time.Duration) domain.PresenceRepository {
+	return &presenceRepository{db: db, ttl: ttl}
+}
+
+func (r *presenceRepository) Touch(instanceID string, userIDs []string, at time.Time) error {
+	if userIDs == nil {
+		// An empty array rather than NULL, which would match nothing.
+		userIDs = []string{}
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM user_presence WHERE (instance_id = $1 AND NOT (user_id = ANY($2))) OR seen_at < $3`,
+		instanceID, pq.Array(userIDs), at.Add(-r.ttl))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO user_presence (user_id, instance_id, seen_at) SELECT unnest($2::text[]), $1, $3
+                      ON CONFLICT (user_id, instance_id) DO UPDATE SET seen_at = EXCLUDED.seen_at`,
+		instanceID, pq.Array(userIDs), at)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *presenceRepository) IsOnline(userID string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM user_presence WHERE user_id = $1 AND seen_at >= $2)`
+	var online bool
+	err := r.db.QueryRow(query, userID, time.Now().Add(-r.ttl)).Scan(&online)
+	return online, err
+}
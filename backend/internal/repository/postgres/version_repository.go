@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"goP2Pbackend/internal/domain"
+)
+
+type versionRepository struct {
+	db *sql.DB
+}
+
+func NewVersionRepository(db *sql.DB) domain.VersionRepository {
+	return &versionRepository{db: db}
+}
+
+const versionColumns = `id, artboard_id, seq, name, created_by, restored_from, created_at`
+
+func scanVersion(row interface{ Scan(...interface{}) error }) (*domain.Version, error) {
+	var version domain.Version
+	var name, createdBy, restoredFrom sql.NullString
+	err := row.Scan(&version.ID, &version.ArtboardID, &version.Seq, &name, &createdBy, &restoredFrom, &version.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	version.Name = name.String
+	version.CreatedBy = createdBy.String
+	version.RestoredFrom = restoredFrom.String
+	return &version, nil
+}
+
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func (r *versionRepository) Create(version *domain.Version) error {
+	query := `INSERT INTO artboard_versions (id, artboard_id, seq, name, created_by, restored_from, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.Exec(query, version.ID, version.ArtboardID, version.Seq, nullableString(version.Name),
+		nullableString(version.CreatedBy), nullableString(version.RestoredFrom), version.CreatedAt)
+	return err
+}
+
+func (r *versionRepository) GetByID(id string) (*domain.Version, error) {
+	query := `SELECT ` + versionColumns + ` FROM artboard_versions WHERE id = $1`
+	version, err := scanVersion(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	return version, err
+}
+
+func (r *versionRepository) ListByArtboard(artboardID string) ([]*domain.Version, error) {
+	query := `SELECT ` + versionColumns + ` FROM artboard_versions WHERE artboard_id = $1 ORDER BY seq DESC, created_at DESC`
+	rows, err := r.db.Query(query, artboardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*domain.Version
+	for rows.Next() {
+		version, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+func (r *versionRepository) Latest(artboardID string) (*domain.Version, error) {
+	query := `SELECT ` + versionColumns + ` FROM artboard_versions WHERE artboard_id = $1 ORDER BY seq DESC, created_at DESC LIMIT 1`
+	version, err := scanVersion(r.db.QueryRow(query, artboardID))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	return version, err
+}
+
+func (r *versionRepository) LatestAt(artboardID string, seq int64) (*domain.Version, error) {
+	query := `SELECT ` + versionColumns + ` FROM artboard_versions WHERE artboard_id = $1 AND seq <= $2 ORDER BY seq DESC, created_at DESC LIMIT 1`
+	version, err := scanVersion(r.db.QueryRow(query, artboardID, seq))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	return version, err
+}
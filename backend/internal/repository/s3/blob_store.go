@@ -0,0 +1,70 @@
+package s3
+
+import (
+	"goP2Pbackend/internal/domain"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+type blobStore struct {
+	s3Client *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+}
+
+// NewBlobStore keeps blobs in an S3 bucket. Data larger than partSize is
+// uploaded in parts of that size, several at a time; smaller data in a
+// single request.
+func NewBlobStore(s3Client *s3.S3, bucket string, partSize int64) domain.BlobStore {
+	return &blobStore{
+		s3Client: s3Client,
+		uploader: s3manager.NewUploaderWithClient(s3Client, func(u *s3manager.Uploader) {
+			u.PartSize = partSize
+		}),
+		bucket: bucket,
+	}
+}
+
+// Put reads parts straight from r when it is a file or other io.ReaderAt
+// and io.Seeker; otherwise each part in flight is buffered in memory.
+func (s *blobStore) Put(key string, r io.Reader, contentEncoding string) error {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	}
+	if contentEncoding != "" {
+		input.ContentEncoding = aws.String(contentEncoding)
+	}
+	_, err := s.uploader.Upload(input)
+	return err
+}
+
+func (s *blobStore) Get(key string) (io.ReadCloser, error) {
+	req, result := s.s3Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	// Keep the HTTP client from decompressing objects stored with a
+	// content encoding; the caller decodes them.
+	req.HTTPRequest.Header.Set("Accept-Encoding", "identity")
+	if err := req.Send(); err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+	return result.Body, nil
+}
+
+func (s *blobStore) Delete(key string) error {
+	_, err := s.s3Client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
@@ -0,0 +1,163 @@
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"goP2Pbackend/internal/domain"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// The integration tests run against an S3-compatible store such as MinIO
+// when S3_TEST_ENDPOINT is set, e.g. to http://localhost:9000. Credentials
+// come from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or anywhere else
+// the default credential chain looks. S3_TEST_BUCKET names the bucket,
+// which is created if missing.
+func testConfig(t *testing.T) (ClientConfig, string) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+	bucket := os.Getenv("S3_TEST_BUCKET")
+	if bucket == "" {
+		bucket = "gop2p-test"
+	}
+	return ClientConfig{
+		Endpoint:       endpoint,
+		ForcePathStyle: true,
+		DisableTLS:     strings.HasPrefix(endpoint, "http://"),
+	}, bucket
+}
+
+// recordURLs notes the URL of every request client sends.
+func recordURLs(client *s3.S3) func() []*url.URL {
+	var mutex sync.Mutex
+	var urls []*url.URL
+	client.Handlers.Send.PushFront(func(r *request.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		urls = append(urls, r.HTTPRequest.URL)
+	})
+	return func() []*url.URL {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return urls
+	}
+}
+
+func createBucket(t *testing.T, client *s3.S3, bucket string) {
+	_, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	var aerr awserr.Error
+	if err != nil && !(errors.As(err, &aerr) && (aerr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou || aerr.Code() == s3.ErrCodeBucketAlreadyExists)) {
+		t.Fatalf("failed to create bucket %s: %v", bucket, err)
+	}
+}
+
+func TestNewClientDefaultsRegionForEndpoint(t *testing.T) {
+	client, err := NewClient(ClientConfig{Endpoint: "http://localhost:9000", ForcePathStyle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if region := aws.StringValue(client.Config.Region); region != defaultRegion {
+		t.Fatalf("region = %q, want %q", region, defaultRegion)
+	}
+	if !aws.BoolValue(client.Config.S3ForcePathStyle) {
+		t.Fatal("path-style addressing not set")
+	}
+}
+
+func TestBlobStoreAgainstEndpoint(t *testing.T) {
+	cfg, bucket := testConfig(t)
+
+	for _, tc := range []struct {
+		name   string
+		cfg    ClientConfig
+		static bool
+	}{
+		// Without keys in the config the SDK's default chain finds them.
+		{"default credential chain", cfg, false},
+		{"static credentials", ClientConfig{
+			Endpoint:        cfg.Endpoint,
+			ForcePathStyle:  cfg.ForcePathStyle,
+			DisableTLS:      cfg.DisableTLS,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.static && tc.cfg.AccessKeyID == "" {
+				t.Skip("AWS_ACCESS_KEY_ID not set")
+			}
+			client, err := NewClient(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			urls := recordURLs(client)
+			createBucket(t, client, bucket)
+			store := NewBlobStore(client, bucket, 5*1024*1024)
+
+			// A content encoding is kept as stored, not undone by the
+			// HTTP client.
+			key := "test/" + strings.ReplaceAll(t.Name(), "/", "-")
+			data := []byte("\x1f\x8b not really gzip")
+			if err := store.Put(key, bytes.NewReader(data), "gzip"); err != nil {
+				t.Fatal(err)
+			}
+			defer store.Delete(key)
+			assertBlob(t, store, key, data)
+
+			// Larger data from a reader that is not an io.ReaderAt goes
+			// up in buffered parts.
+			large := bytes.Repeat([]byte("0123456789abcdef"), 11*1024*1024/16)
+			largeKey := key + "-large"
+			if err := store.Put(largeKey, io.MultiReader(bytes.NewReader(large)), ""); err != nil {
+				t.Fatal(err)
+			}
+			defer store.Delete(largeKey)
+			assertBlob(t, store, largeKey, large)
+
+			if err := store.Delete(key); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get(key); !errors.Is(err, domain.ErrNotFound) {
+				t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+			}
+
+			endpoint, err := url.Parse(cfg.Endpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range urls() {
+				if u.Host != endpoint.Host || !strings.HasPrefix(u.Path, "/"+bucket) {
+					t.Fatalf("request to %s is not path-style on %s", u, cfg.Endpoint)
+				}
+			}
+		})
+	}
+}
+
+func assertBlob(t *testing.T, store domain.BlobStore, key string, want []byte) {
+	t.Helper()
+	body, err := store.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	got, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s read back %d bytes, want the %d written", key, len(got), len(want))
+	}
+}
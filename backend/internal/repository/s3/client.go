@@ -1,20 +1,75 @@
-package s3
-
-import (
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-)
-
-func NewClient(region, accessKeyID, secretAccessKey string) (*s3.S3, error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String(region),
-		Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return s3.New(sess), nil
-}
+package s3
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ClientConfig describes how to reach S3 or an S3-compatible store such as
+// MinIO.
+type ClientConfig struct {
+	Region string
+	// Endpoint overrides the AWS endpoint, e.g. "https://minio.internal:9000".
+	Endpoint string
+	// Without static keys the default credential chain is used: the
+	// environment, the shared config and credentials files, then the
+	// instance or task role.
+	AccessKeyID     string
+	SecretAccessKey string
+	// ForcePathStyle addresses buckets as endpoint/bucket/key rather than
+	// bucket.endpoint/key, as most S3-compatible stores need.
+	ForcePathStyle bool
+	// DisableTLS uses plain HTTP for an endpoint given without a scheme.
+	DisableTLS bool
+	// CABundle is a PEM file of extra certificate authorities to trust,
+	// for stores with a private CA.
+	CABundle string
+}
+
+// defaultRegion is used against a custom endpoint when no region is set;
+// requests must be signed for some region, and S3-compatible stores
+// generally accept this one.
+const defaultRegion = "us-east-1"
+
+func NewClient(cfg ClientConfig) (*s3.S3, error) {
+	awsConfig := &aws.Config{
+		S3ForcePathStyle: aws.Bool(cfg.ForcePathStyle),
+		DisableSSL:       aws.Bool(cfg.DisableTLS),
+	}
+	if cfg.Region != "" {
+		awsConfig.Region = aws.String(cfg.Region)
+	} else if cfg.Endpoint != "" {
+		awsConfig.Region = aws.String(defaultRegion)
+	}
+	if cfg.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(cfg.Endpoint)
+	}
+	if cfg.AccessKeyID != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, "")
+	}
+
+	options := session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigEnable,
+	}
+	if cfg.CABundle != "" {
+		bundle, err := os.Open(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open CA bundle: %w", err)
+		}
+		defer bundle.Close()
+		options.CustomCABundle = bundle
+	}
+
+	sess, err := session.NewSessionWithOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.New(sess), nil
+}
@@ -0,0 +1,374 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/envelope"
+)
+
+// Saves that lose a race with garbage collection start over this many times.
+const maxSaveAttempts = 3
+
+type artboardStorage struct {
+	blobs    domain.BlobStore
+	blobRepo domain.BlobRepository
+	encoding string
+	// keys is nil unless data is encrypted.
+	keys *dataKeys
+}
+
+// NewArtboardStorage stores artboard data content-addressed in blobs: each
+// save is compressed with encoding and kept under the hash of its content,
+// so identical snapshots across versions and branches are stored once.
+// blobRepo tracks which artboard or version points at which blob. Data saved
+// before content addressing is still read from its old key.
+//
+// With a keyring, data is also encrypted with a data key per artboard,
+// kept in keyRepo wrapped by the keyring's master key. Encrypted data is
+// only deduplicated within its artboard.
+func NewArtboardStorage(blobs domain.BlobStore, blobRepo domain.BlobRepository, encoding string, keyRepo domain.DataKeyRepository, keyring *envelope.Keyring) domain.ArtboardStorage {
+	s := &artboardStorage{
+		blobs:    blobs,
+		blobRepo: blobRepo,
+		encoding: encoding,
+	}
+	if keyring != nil {
+		s.keys = &dataKeys{keyRepo: keyRepo, keyring: keyring, cache: make(map[string][]byte)}
+	}
+	return s
+}
+
+func artboardRef(artboardID string) string {
+	return "artboards/" + artboardID
+}
+
+func versionRef(artboardID, versionID string) string {
+	return "artboards/" + artboardID + "/versions/" + versionID
+}
+
+// legacyKey is where data was kept before content addressing.
+func legacyKey(ref string) string {
+	return ref[len("artboards/"):]
+}
+
+// legacyStore is implemented by blob stores that laid out data saved
+// before content addressing differently from other keys.
+type legacyStore interface {
+	GetLegacy(key string) (io.ReadCloser, error)
+}
+
+func blobKey(hash string) string {
+	return "blobs/" + hash
+}
+
+func (s *artboardStorage) Save(artboardID string, data []byte) error {
+	return s.saveBytes(artboardRef(artboardID), artboardID, data)
+}
+
+func (s *artboardStorage) Load(artboardID string) ([]byte, error) {
+	return s.load(artboardRef(artboardID))
+}
+
+func (s *artboardStorage) SaveVersion(artboardID, versionID string, data []byte) error {
+	return s.saveBytes(versionRef(artboardID, versionID), artboardID, data)
+}
+
+func (s *artboardStorage) LoadVersion(artboardID, versionID string) ([]byte, error) {
+	return s.load(versionRef(artboardID, versionID))
+}
+
+// SaveFrom spools the stream to temporary files while it is hashed,
+// compressed and encrypted, so only a few buffers of it are held in memory.
+func (s *artboardStorage) SaveFrom(artboardID string, r io.Reader) error {
+	return s.save(artboardRef(artboardID), artboardID, r, newFileSpool)
+}
+
+func (s *artboardStorage) LoadTo(artboardID string, w io.Writer) error {
+	r, err := s.open(artboardRef(artboardID))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// Delete drops the references of the artboard and its versions; garbage
+// collection removes whatever blobs nothing else points at.
+func (s *artboardStorage) Delete(artboardID string) error {
+	if err := s.blobRepo.Unref(artboardRef(artboardID)); err != nil {
+		return fmt.Errorf("failed to release data of %s: %w", artboardID, err)
+	}
+	return nil
+}
+
+// dataKey returns the key to encrypt an artboard's data with, or nil if
+// data is not encrypted.
+func (s *artboardStorage) dataKey(artboardID string) ([]byte, error) {
+	if s.keys == nil {
+		return nil, nil
+	}
+	return s.keys.get(artboardID, true)
+}
+
+// contentHash hashes data into its blob's hash.
+func contentHash(dataKey []byte) hash.Hash {
+	if dataKey == nil {
+		return sha256.New()
+	}
+	return envelope.ContentHash(dataKey)
+}
+
+// sealed is data prepared for storing: the blob to record and the bytes to
+// store for it, compressed, then encrypted if there is a data key.
+type sealed struct {
+	blob *domain.Blob
+	body spool
+}
+
+// seal reads data into a spool, sealing it with encoding and dataKey.
+// Encrypting takes a second pass over the compressed data, which the salt
+// of its encryption is derived from.
+func seal(encoding string, dataKey []byte, data io.Reader, newBody newSpool) (*sealed, error) {
+	blob := &domain.Blob{
+		Encoding:  encoding,
+		CreatedAt: time.Now(),
+	}
+	content := contentHash(dataKey)
+	stored := sha256.New()
+
+	compressed, err := newBody()
+	if err != nil {
+		return nil, err
+	}
+	var salt hash.Hash
+	out := io.MultiWriter(compressed, stored)
+	if dataKey != nil {
+		salt = envelope.StreamSalt(dataKey)
+		out = io.MultiWriter(compressed, salt)
+	}
+	if err := compress(encoding, out, io.TeeReader(data, content), &blob.Size); err != nil {
+		compressed.remove()
+		return nil, err
+	}
+	blob.Hash = hex.EncodeToString(content.Sum(nil))
+	if dataKey == nil {
+		blob.Checksum = hex.EncodeToString(stored.Sum(nil))
+		blob.StoredSize = compressed.size()
+		return &sealed{blob: blob, body: compressed}, nil
+	}
+
+	defer compressed.remove()
+	encrypted, err := newBody()
+	if err != nil {
+		return nil, err
+	}
+	if err := encrypt(dataKey, salt.Sum(nil), io.MultiWriter(encrypted, stored), compressed); err != nil {
+		encrypted.remove()
+		return nil, err
+	}
+	blob.Segmented = true
+	blob.Checksum = hex.EncodeToString(stored.Sum(nil))
+	blob.StoredSize = encrypted.size()
+	return &sealed{blob: blob, body: encrypted}, nil
+}
+
+// compress copies data into w compressed with encoding and counts it into
+// size.
+func compress(encoding string, w io.Writer, data io.Reader, size *int64) error {
+	encoder, err := newEncoder(encoding, w)
+	if err != nil {
+		return fmt.Errorf("failed to compress data: %w", err)
+	}
+	*size, err = io.Copy(encoder, data)
+	if closeErr := encoder.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to compress data: %w", err)
+	}
+	return nil
+}
+
+// encrypt copies what is in compressed into w, encrypted.
+func encrypt(dataKey, salt []byte, w io.Writer, compressed spool) error {
+	r, err := compressed.reader()
+	if err != nil {
+		return err
+	}
+	encrypter, err := envelope.NewEncrypter(dataKey, salt, w)
+	if err == nil {
+		if _, err = io.Copy(encrypter, r); err == nil {
+			err = encrypter.Close()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encrypt data: %w", err)
+	}
+	return nil
+}
+
+// saveBytes saves data already in memory. Unlike a stream, it can be hashed
+// before anything else, to skip the rest when ref already points at it.
+func (s *artboardStorage) saveBytes(ref, artboardID string, data []byte) error {
+	dataKey, err := s.dataKey(artboardID)
+	if err != nil {
+		return err
+	}
+	content := contentHash(dataKey)
+	content.Write(data)
+	if stored, err := s.blobRepo.Resolve(ref); err == nil && stored.Hash == hex.EncodeToString(content.Sum(nil)) {
+		return nil
+	}
+	return s.save(ref, artboardID, bytes.NewReader(data), newMemorySpool)
+}
+
+func (s *artboardStorage) save(ref, artboardID string, data io.Reader, newBody newSpool) error {
+	dataKey, err := s.dataKey(artboardID)
+	if err != nil {
+		return err
+	}
+	prepared, err := seal(s.encoding, dataKey, data, newBody)
+	if err != nil {
+		return err
+	}
+	defer prepared.body.remove()
+	blob := prepared.blob
+	if dataKey != nil {
+		blob.KeyID = artboardID
+	}
+	if stored, err := s.blobRepo.Resolve(ref); err == nil && stored.Hash == blob.Hash {
+		return nil
+	}
+
+	// Record the blob before writing it, so that garbage collection of the
+	// same content either finishes first or sees the new reference. A known
+	// blob is written again unless something references it, since
+	// collection may be removing the data right now; the reference then
+	// finds the record gone.
+	for attempt := 1; ; attempt++ {
+		if err := s.blobRepo.Create(blob); err != nil {
+			return fmt.Errorf("failed to record blob: %w", err)
+		}
+		recorded, err := s.blobRepo.Get(blob.Hash)
+		if err == nil && recorded.RefCount == 0 {
+			err = s.write(recorded, dataKey, prepared, newBody)
+		}
+		if err == nil {
+			err = s.blobRepo.Ref(ref, blob.Hash)
+		}
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, domain.ErrNotFound) || attempt == maxSaveAttempts {
+			return fmt.Errorf("failed to reference blob: %w", err)
+		}
+	}
+}
+
+// write stores the data of a recorded blob, keeping the encoding it was
+// first recorded with.
+func (s *artboardStorage) write(recorded *domain.Blob, dataKey []byte, prepared *sealed, newBody newSpool) error {
+	if recorded.Encoding != prepared.blob.Encoding {
+		resealed, err := reseal(prepared, dataKey, recorded.Encoding, newBody)
+		if err != nil {
+			return err
+		}
+		defer resealed.body.remove()
+		prepared = resealed
+	}
+
+	body, err := prepared.body.reader()
+	if err != nil {
+		return err
+	}
+	header := contentEncoding(recorded.Encoding)
+	if dataKey != nil {
+		header = ""
+	}
+	if err := s.blobs.Put(blobKey(recorded.Hash), body, header); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+
+	// A different build of a compressor may produce different bytes, and
+	// blobs recorded before segmenting were encrypted whole.
+	written := prepared.blob
+	if written.Checksum != recorded.Checksum || written.StoredSize != recorded.StoredSize || written.Segmented != recorded.Segmented {
+		recorded.Checksum = written.Checksum
+		recorded.StoredSize = written.StoredSize
+		recorded.Segmented = written.Segmented
+		if err := s.blobRepo.UpdateStored(recorded); err != nil {
+			return fmt.Errorf("failed to record blob: %w", err)
+		}
+	}
+	return nil
+}
+
+// reseal seals prepared data again with another encoding.
+func reseal(prepared *sealed, dataKey []byte, encoding string, newBody newSpool) (*sealed, error) {
+	body, err := prepared.body.reader()
+	if err != nil {
+		return nil, err
+	}
+	data, err := openBlob(prepared.blob, dataKey, io.NopCloser(body))
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	return seal(encoding, dataKey, data, newBody)
+}
+
+// openLegacy reads ref from where it was kept before content addressing.
+func (s *artboardStorage) openLegacy(ref string) (io.ReadCloser, error) {
+	if legacy, ok := s.blobs.(legacyStore); ok {
+		return legacy.GetLegacy(legacyKey(ref))
+	}
+	return s.blobs.Get(legacyKey(ref))
+}
+
+// open starts reading the data ref points at.
+func (s *artboardStorage) open(ref string) (io.ReadCloser, error) {
+	blob, err := s.blobRepo.Resolve(ref)
+	if errors.Is(err, domain.ErrNotFound) {
+		return s.openLegacy(ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", ref, err)
+	}
+
+	var dataKey []byte
+	if blob.KeyID != "" {
+		if s.keys == nil {
+			return nil, ErrNoMasterKey
+		}
+		if dataKey, err = s.keys.get(blob.KeyID, false); err != nil {
+			return nil, err
+		}
+	}
+	body, err := s.blobs.Get(blobKey(blob.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load blob %s: %w", blob.Hash, err)
+	}
+	data, err := openBlob(blob, dataKey, body)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *artboardStorage) load(ref string) ([]byte, error) {
+	r, err := s.open(ref)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
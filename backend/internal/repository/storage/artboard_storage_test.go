@@ -0,0 +1,483 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/internal/repository/memory"
+	"goP2Pbackend/pkg/envelope"
+)
+
+// fakeBlobRepo keeps blob records in memory the way the Postgres
+// repository keeps them in storage_blobs and storage_refs.
+type fakeBlobRepo struct {
+	mutex sync.Mutex
+	blobs map[string]*domain.Blob
+	// When each blob lost its last reference, or was created without one.
+	unreferencedAt map[string]time.Time
+	refs           map[string]string
+}
+
+func newFakeBlobRepo() *fakeBlobRepo {
+	return &fakeBlobRepo{
+		blobs:          make(map[string]*domain.Blob),
+		unreferencedAt: make(map[string]time.Time),
+		refs:           make(map[string]string),
+	}
+}
+
+func (r *fakeBlobRepo) Create(blob *domain.Blob) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.blobs[blob.Hash]; ok {
+		return nil
+	}
+	recorded := *blob
+	recorded.RefCount = 0
+	r.blobs[blob.Hash] = &recorded
+	r.unreferencedAt[blob.Hash] = blob.CreatedAt
+	return nil
+}
+
+func (r *fakeBlobRepo) Ref(key, hash string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	previous, ok := r.refs[key]
+	if ok && previous == hash {
+		return nil
+	}
+	blob, found := r.blobs[hash]
+	if !found {
+		return domain.ErrNotFound
+	}
+	blob.RefCount++
+	delete(r.unreferencedAt, hash)
+	r.refs[key] = hash
+	if ok {
+		r.drop(previous, 1)
+	}
+	return nil
+}
+
+// drop takes n references from a blob.
+func (r *fakeBlobRepo) drop(hash string, n int) {
+	blob := r.blobs[hash]
+	blob.RefCount -= n
+	if blob.RefCount == 0 {
+		r.unreferencedAt[hash] = time.Now()
+	}
+}
+
+func (r *fakeBlobRepo) Get(hash string) (*domain.Blob, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	blob, ok := r.blobs[hash]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	copied := *blob
+	return &copied, nil
+}
+
+func (r *fakeBlobRepo) Resolve(key string) (*domain.Blob, error) {
+	r.mutex.Lock()
+	hash, ok := r.refs[key]
+	r.mutex.Unlock()
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return r.Get(hash)
+}
+
+func (r *fakeBlobRepo) List(afterHash string, limit int) ([]*domain.Blob, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var blobs []*domain.Blob
+	for hash, blob := range r.blobs {
+		if hash > afterHash {
+			copied := *blob
+			blobs = append(blobs, &copied)
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Hash < blobs[j].Hash })
+	if len(blobs) > limit {
+		blobs = blobs[:limit]
+	}
+	return blobs, nil
+}
+
+func (r *fakeBlobRepo) ListRefs(hash string) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var keys []string
+	for key, to := range r.refs {
+		if to == hash {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (r *fakeBlobRepo) Unref(key string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for ref, hash := range r.refs {
+		if ref == key || strings.HasPrefix(ref, key+"/") {
+			delete(r.refs, ref)
+			r.drop(hash, 1)
+		}
+	}
+	return nil
+}
+
+func (r *fakeBlobRepo) UpdateStored(blob *domain.Blob) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if recorded, ok := r.blobs[blob.Hash]; ok {
+		recorded.Checksum = blob.Checksum
+		recorded.StoredSize = blob.StoredSize
+		recorded.Segmented = blob.Segmented
+	}
+	return nil
+}
+
+func (r *fakeBlobRepo) ListUnreferenced(before time.Time, limit int) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var hashes []string
+	for hash, at := range r.unreferencedAt {
+		if r.blobs[hash].RefCount == 0 && at.Before(before) && len(hashes) < limit {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
+
+func (r *fakeBlobRepo) Delete(hash string, remove func() error) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	blob, ok := r.blobs[hash]
+	if !ok || blob.RefCount > 0 {
+		return false, nil
+	}
+	if err := remove(); err != nil {
+		return false, err
+	}
+	delete(r.blobs, hash)
+	delete(r.unreferencedAt, hash)
+	return true, nil
+}
+
+// age backdates when a blob lost its last reference.
+func (r *fakeBlobRepo) age(hash string, by time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.unreferencedAt[hash] = r.unreferencedAt[hash].Add(-by)
+}
+
+type fakeDataKeyRepo struct {
+	mutex sync.Mutex
+	keys  map[string]*domain.DataKey
+}
+
+func (r *fakeDataKeyRepo) Create(key *domain.DataKey) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.keys[key.ArtboardID]; !ok {
+		r.keys[key.ArtboardID] = key
+	}
+	return nil
+}
+
+func (r *fakeDataKeyRepo) Get(artboardID string) (*domain.DataKey, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	key, ok := r.keys[artboardID]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return key, nil
+}
+
+func (r *fakeDataKeyRepo) ListWrappedWithout(masterKeyID string, limit int) ([]*domain.DataKey, error) {
+	return nil, nil
+}
+
+func (r *fakeDataKeyRepo) Rewrap(key *domain.DataKey, previousMasterKeyID string) error {
+	return nil
+}
+
+// testStorage is an artboardStorage over a memory blob store, with the
+// stores kept at hand for tests to inspect and damage.
+type testStorage struct {
+	domain.ArtboardStorage
+	blobs    domain.BlobStore
+	blobRepo *fakeBlobRepo
+}
+
+func newTestStorage(t *testing.T, encoding string, encrypted bool) *testStorage {
+	t.Helper()
+	var keyring *envelope.Keyring
+	if encrypted {
+		var err error
+		keyring, err = envelope.ParseKeys(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, envelope.KeySize)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	blobs := memory.NewBlobStore()
+	blobRepo := newFakeBlobRepo()
+	keyRepo := &fakeDataKeyRepo{keys: make(map[string]*domain.DataKey)}
+	return &testStorage{
+		ArtboardStorage: NewArtboardStorage(blobs, blobRepo, encoding, keyRepo, keyring),
+		blobs:           blobs,
+		blobRepo:        blobRepo,
+	}
+}
+
+// resolve returns the blob ref points at.
+func (s *testStorage) resolve(t *testing.T, ref string) *domain.Blob {
+	t.Helper()
+	blob, err := s.blobRepo.Resolve(ref)
+	if err != nil {
+		t.Fatalf("resolving %s: %v", ref, err)
+	}
+	return blob
+}
+
+// stored returns the bytes kept for a blob.
+func (s *testStorage) stored(t *testing.T, hash string) []byte {
+	t.Helper()
+	body, err := s.blobs.Get(blobKey(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// testData returns size bytes that compress somewhat but not entirely.
+func testData(size int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < size; i++ {
+		fmt.Fprintf(&buf, `{"id":"obj-%d","x":%d,"y":%d},`, i, i*7919%1000, i*104729%1000)
+	}
+	return buf.Bytes()[:size]
+}
+
+var encodings = []string{EncodingNone, EncodingGzip, EncodingZstd}
+
+func TestSaveAndLoadRoundTrip(t *testing.T) {
+	// Large enough to span several encryption segments.
+	data := testData(300 << 10)
+	for _, encoding := range encodings {
+		for _, encrypted := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/encrypted=%v", encoding, encrypted), func(t *testing.T) {
+				s := newTestStorage(t, encoding, encrypted)
+
+				if err := s.Save("board", data); err != nil {
+					t.Fatal(err)
+				}
+				got, err := s.Load("board")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatalf("Load returned %d bytes, want the %d saved", len(got), len(data))
+				}
+
+				if err := s.SaveFrom("streamed", bytes.NewReader(data)); err != nil {
+					t.Fatal(err)
+				}
+				var out bytes.Buffer
+				if err := s.LoadTo("streamed", &out); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(out.Bytes(), data) {
+					t.Fatalf("LoadTo wrote %d bytes, want the %d saved", out.Len(), len(data))
+				}
+
+				blob := s.resolve(t, artboardRef("board"))
+				if blob.Encoding != encoding || blob.Size != int64(len(data)) || blob.Segmented != encrypted {
+					t.Fatalf("recorded %+v", blob)
+				}
+				stored := s.stored(t, blob.Hash)
+				if int64(len(stored)) != blob.StoredSize {
+					t.Fatalf("stored %d bytes, recorded %d", len(stored), blob.StoredSize)
+				}
+				if encoding != EncodingNone && len(stored) >= len(data) {
+					t.Fatalf("%s stored %d bytes of %d", encoding, len(stored), len(data))
+				}
+				if !encrypted && encoding == EncodingGzip && !bytes.HasPrefix(stored, []byte{0x1f, 0x8b}) {
+					t.Fatal("gzip blob is not stored as gzip")
+				}
+				if encrypted && bytes.Contains(stored, data[:64]) {
+					t.Fatal("encrypted blob holds plaintext")
+				}
+			})
+		}
+	}
+}
+
+func TestSaveDeduplicatesAndCountsReferences(t *testing.T) {
+	data := testData(4 << 10)
+	other := testData(5 << 10)
+	for _, encrypted := range []bool{false, true} {
+		t.Run(fmt.Sprintf("encrypted=%v", encrypted), func(t *testing.T) {
+			s := newTestStorage(t, EncodingGzip, encrypted)
+			for _, save := range []func() error{
+				func() error { return s.Save("a", data) },
+				func() error { return s.SaveVersion("a", "v1", data) },
+				// Saving again what a key already points at changes nothing.
+				func() error { return s.Save("a", data) },
+				func() error { return s.Save("b", data) },
+			} {
+				if err := save(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Encrypted data is only deduplicated within its artboard.
+			refs, separate := 3, 0
+			if encrypted {
+				refs, separate = 2, 1
+			}
+			shared := s.resolve(t, artboardRef("a"))
+			if v1 := s.resolve(t, versionRef("a", "v1")); v1.Hash != shared.Hash || shared.RefCount != refs {
+				t.Fatalf("a and its version point at %s and %s with %d references, want one blob with %d", shared.Hash, v1.Hash, shared.RefCount, refs)
+			}
+			b := s.resolve(t, artboardRef("b"))
+			if encrypted == (b.Hash == shared.Hash) {
+				t.Fatalf("b shares a's blob: %v, want %v", b.Hash == shared.Hash, !encrypted)
+			}
+			if blobs, _ := s.blobRepo.List("", 10); len(blobs) != 1+separate {
+				t.Fatalf("%d blobs recorded, want %d", len(blobs), 1+separate)
+			}
+
+			// Moving a reference releases the blob it pointed at.
+			if err := s.Save("a", other); err != nil {
+				t.Fatal(err)
+			}
+			if before, _ := s.blobRepo.Get(shared.Hash); before.RefCount != shared.RefCount-1 {
+				t.Fatalf("old blob has %d references after a moved, want %d", before.RefCount, shared.RefCount-1)
+			}
+			if moved := s.resolve(t, artboardRef("a")); moved.RefCount != 1 {
+				t.Fatalf("new blob has %d references, want 1", moved.RefCount)
+			}
+			for ref, want := range map[string][]byte{"a": other, "b": data} {
+				got, err := s.Load(ref)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("%s loaded back different data", ref)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteReleasesVersionsOnlyOfThatArtboard(t *testing.T) {
+	s := newTestStorage(t, EncodingZstd, false)
+	for _, save := range []struct {
+		artboardID, versionID string
+		data                  []byte
+	}{
+		{"a", "", testData(1000)},
+		{"a", "v1", testData(1001)},
+		{"a", "v2", testData(1002)},
+		// "ab" starts with "a" but is not below it.
+		{"ab", "", testData(1003)},
+		{"ab", "v1", testData(1004)},
+	} {
+		var err error
+		if save.versionID == "" {
+			err = s.Save(save.artboardID, save.data)
+		} else {
+			err = s.SaveVersion(save.artboardID, save.versionID, save.data)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	released := []*domain.Blob{s.resolve(t, artboardRef("a")), s.resolve(t, versionRef("a", "v1")), s.resolve(t, versionRef("a", "v2"))}
+
+	if err := s.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("a"); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("Load after Delete = %v, want ErrNotFound", err)
+	}
+	if _, err := s.LoadVersion("a", "v2"); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("LoadVersion after Delete = %v, want ErrNotFound", err)
+	}
+	for _, blob := range released {
+		if after, _ := s.blobRepo.Get(blob.Hash); after.RefCount != 0 {
+			t.Fatalf("blob %s kept %d references", blob.Hash, after.RefCount)
+		}
+	}
+	if _, err := s.Load("ab"); err != nil {
+		t.Fatalf("Load of ab after deleting a: %v", err)
+	}
+	if _, err := s.LoadVersion("ab", "v1"); err != nil {
+		t.Fatalf("LoadVersion of ab after deleting a: %v", err)
+	}
+}
+
+func TestCollectGarbageWaitsForGracePeriod(t *testing.T) {
+	const grace = time.Hour
+	s := newTestStorage(t, EncodingGzip, false)
+	data := testData(2000)
+	if err := s.Save("a", data); err != nil {
+		t.Fatal(err)
+	}
+	old := s.resolve(t, artboardRef("a"))
+	if err := s.Save("a", testData(3000)); err != nil {
+		t.Fatal(err)
+	}
+	kept := s.resolve(t, artboardRef("a"))
+
+	// Just released: within the grace period.
+	if deleted, err := CollectGarbage(s.blobs, s.blobRepo, grace); err != nil || deleted != 0 {
+		t.Fatalf("CollectGarbage = %d, %v; want nothing deleted yet", deleted, err)
+	}
+	if _, err := s.blobs.Get(blobKey(old.Hash)); err != nil {
+		t.Fatalf("blob within the grace period is gone: %v", err)
+	}
+
+	s.blobRepo.age(old.Hash, 2*grace)
+	if deleted, err := CollectGarbage(s.blobs, s.blobRepo, grace); err != nil || deleted != 1 {
+		t.Fatalf("CollectGarbage = %d, %v; want 1 deleted", deleted, err)
+	}
+	if _, err := s.blobs.Get(blobKey(old.Hash)); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("collected blob is still stored: %v", err)
+	}
+	if _, err := s.blobRepo.Get(old.Hash); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("collected blob is still recorded: %v", err)
+	}
+	if _, err := s.blobs.Get(blobKey(kept.Hash)); err != nil {
+		t.Fatalf("referenced blob was collected: %v", err)
+	}
+
+	// The same content can be saved again afterwards.
+	if err := s.SaveVersion("a", "v1", data); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.LoadVersion("a", "v1"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("LoadVersion after collection = %d bytes, %v", len(got), err)
+	}
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"fmt"
+
+	"goP2Pbackend/config"
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/internal/repository/filesystem"
+	"goP2Pbackend/internal/repository/memory"
+	"goP2Pbackend/internal/repository/s3"
+)
+
+// OpenBlobStore creates the blob store selected by STORAGE_DRIVER.
+func OpenBlobStore(cfg *config.Config) (domain.BlobStore, error) {
+	switch cfg.Storage.Driver {
+	case "fs":
+		return filesystem.NewBlobStore(cfg.Storage.Path)
+	case "memory":
+		return memory.NewBlobStore(), nil
+	default:
+		s3Client, err := s3.NewClient(s3.ClientConfig{
+			Region:          cfg.AWS.Region,
+			Endpoint:        cfg.AWS.Endpoint,
+			AccessKeyID:     cfg.AWS.AccessKeyID,
+			SecretAccessKey: cfg.AWS.SecretAccessKey,
+			ForcePathStyle:  cfg.AWS.ForcePathStyle,
+			DisableTLS:      cfg.AWS.DisableTLS,
+			CABundle:        cfg.AWS.CABundle,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create S3 client: %w", err)
+		}
+		return s3.NewBlobStore(s3Client, cfg.AWS.BucketName, cfg.AWS.PartSize), nil
+	}
+}
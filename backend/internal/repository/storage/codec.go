@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression encodings of stored blobs. The names double as the
+// Content-Encoding of objects in S3.
+const (
+	EncodingNone = "none"
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// ValidEncoding reports whether blobs can be written with encoding.
+func ValidEncoding(encoding string) bool {
+	return encoding == EncodingNone || encoding == EncodingGzip || encoding == EncodingZstd
+}
+
+// newEncoder returns a writer that compresses what is written to it into w.
+// Closing it finishes the stream but does not close w.
+func newEncoder(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case EncodingNone:
+		return nopWriteCloser{w}, nil
+	case EncodingGzip:
+		return gzip.NewWriter(w), nil
+	case EncodingZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
+
+// newDecoder returns a reader that decompresses r.
+func newDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingNone:
+		return io.NopCloser(r), nil
+	case EncodingGzip:
+		return gzip.NewReader(r)
+	case EncodingZstd:
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zstdReadCloser{decoder}, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (d zstdReadCloser) Close() error {
+	d.Decoder.Close()
+	return nil
+}
+
+// contentEncoding is the Content-Encoding header for an encoding.
+func contentEncoding(encoding string) string {
+	if encoding == EncodingNone {
+		return ""
+	}
+	return encoding
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/envelope"
+)
+
+// ErrNoMasterKey is returned when reading encrypted data without a master
+// key configured.
+var ErrNoMasterKey = errors.New("data is encrypted but no master key is configured")
+
+// dataKeys hands out artboard data keys, creating them on first use. Data
+// keys never change, only their wrapping, so they are cached unwrapped.
+type dataKeys struct {
+	keyRepo domain.DataKeyRepository
+	keyring *envelope.Keyring
+	mutex   sync.Mutex
+	cache   map[string][]byte
+}
+
+func (d *dataKeys) get(artboardID string, create bool) ([]byte, error) {
+	d.mutex.Lock()
+	dataKey, ok := d.cache[artboardID]
+	d.mutex.Unlock()
+	if ok {
+		return dataKey, nil
+	}
+
+	stored, err := d.keyRepo.Get(artboardID)
+	if errors.Is(err, domain.ErrNotFound) && create {
+		if err := d.create(artboardID); err != nil {
+			return nil, err
+		}
+		// Another instance may have created one first; use whichever won.
+		stored, err = d.keyRepo.Get(artboardID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load data key of %s: %w", artboardID, err)
+	}
+	dataKey, err = d.keyring.Unwrap(stored.WrappedKey, stored.MasterKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key of %s: %w", artboardID, err)
+	}
+
+	d.mutex.Lock()
+	d.cache[artboardID] = dataKey
+	d.mutex.Unlock()
+	return dataKey, nil
+}
+
+func (d *dataKeys) create(artboardID string) error {
+	dataKey, err := envelope.GenerateKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, masterKeyID, err := d.keyring.Wrap(dataKey)
+	if err != nil {
+		return fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	err = d.keyRepo.Create(&domain.DataKey{
+		ArtboardID:  artboardID,
+		WrappedKey:  wrapped,
+		MasterKeyID: masterKeyID,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save data key: %w", err)
+	}
+	return nil
+}
+
+// RotateKeys re-wraps every data key that is not wrapped with the
+// keyring's current master key, and returns how many it re-wrapped. The
+// data itself is untouched. Once it returns, older master keys can be
+// dropped from the keyring.
+func RotateKeys(keyRepo domain.DataKeyRepository, keyring *envelope.Keyring) (int, error) {
+	current := keyring.CurrentKeyID()
+	rotated := 0
+	for {
+		keys, err := keyRepo.ListWrappedWithout(current, gcBatchSize)
+		if err != nil {
+			return rotated, fmt.Errorf("failed to list data keys: %w", err)
+		}
+		if len(keys) == 0 {
+			return rotated, nil
+		}
+		for _, key := range keys {
+			dataKey, err := keyring.Unwrap(key.WrappedKey, key.MasterKeyID)
+			if err != nil {
+				return rotated, fmt.Errorf("failed to unwrap data key of %s: %w", key.ArtboardID, err)
+			}
+			previous := key.MasterKeyID
+			if key.WrappedKey, key.MasterKeyID, err = keyring.Wrap(dataKey); err != nil {
+				return rotated, fmt.Errorf("failed to wrap data key of %s: %w", key.ArtboardID, err)
+			}
+			now := time.Now()
+			key.RotatedAt = &now
+			if err := keyRepo.Rewrap(key, previous); err != nil {
+				return rotated, fmt.Errorf("failed to save data key of %s: %w", key.ArtboardID, err)
+			}
+			rotated++
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+)
+
+const gcBatchSize = 1000
+
+// CollectGarbage deletes the blobs that nothing has pointed at for longer
+// than grace and returns how many it deleted. The grace period keeps blobs
+// that are being saved right now.
+func CollectGarbage(blobs domain.BlobStore, blobRepo domain.BlobRepository, grace time.Duration) (int, error) {
+	before := time.Now().Add(-grace)
+	deleted := 0
+	for {
+		hashes, err := blobRepo.ListUnreferenced(before, gcBatchSize)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list unreferenced blobs: %w", err)
+		}
+		for _, hash := range hashes {
+			ok, err := blobRepo.Delete(hash, func() error {
+				return blobs.Delete(blobKey(hash))
+			})
+			if err != nil {
+				return deleted, err
+			}
+			if ok {
+				deleted++
+			}
+		}
+		if len(hashes) < gcBatchSize {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/envelope"
+)
+
+// hashingReader hashes what it reads and keeps the first error of the
+// underlying reader.
+type hashingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	err  error
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	if err != nil && err != io.EOF && h.err == nil {
+		h.err = err
+	}
+	return n, err
+}
+
+func (h *hashingReader) sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+func checksumMismatch(blob *domain.Blob) error {
+	return fmt.Errorf("blob %s does not match its checksum: %w", blob.Hash, domain.ErrCorrupt)
+}
+
+// blobReader reads the data of a blob from its bytes as stored, checking it
+// on the way. Encrypted segments are authenticated before any of their data
+// is returned. The rest is checked at the end: the bytes as stored against
+// the blob's checksum, unless it has none, and unencrypted data against its
+// content hash. A mismatch fails the last read with ErrCorrupt instead of
+// io.EOF, after the data before it has been returned.
+type blobReader struct {
+	blob   *domain.Blob
+	body   io.ReadCloser
+	stored *hashingReader
+	data   io.ReadCloser
+	// content hashes the data of unencrypted blobs.
+	content hash.Hash
+	err     error
+}
+
+// openBlob starts reading a blob from body, which it closes when closed
+// itself or on failure. dataKey is nil for unencrypted blobs.
+func openBlob(blob *domain.Blob, dataKey []byte, body io.ReadCloser) (*blobReader, error) {
+	r := &blobReader{
+		blob:   blob,
+		body:   body,
+		stored: &hashingReader{r: body, hash: sha256.New()},
+	}
+	var sealed io.Reader = r.stored
+	var err error
+	switch {
+	case blob.KeyID == "":
+		r.content = sha256.New()
+	case blob.Segmented:
+		sealed, err = envelope.NewDecrypter(dataKey, sealed)
+	default:
+		// Blobs encrypted before segmenting are sealed whole.
+		var whole []byte
+		if whole, err = io.ReadAll(sealed); err == nil {
+			whole, err = envelope.Decrypt(dataKey, whole)
+			sealed = bytes.NewReader(whole)
+		}
+	}
+	if err == nil {
+		r.data, err = newDecoder(blob.Encoding, sealed)
+	}
+	if err != nil {
+		body.Close()
+		return nil, r.problem(err)
+	}
+	return r, nil
+}
+
+func (r *blobReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.data.Read(p)
+	if r.content != nil {
+		r.content.Write(p[:n])
+	}
+	switch {
+	case err == io.EOF:
+		if problem := r.verify(); problem != nil {
+			r.err = problem
+			return n, problem
+		}
+	case err != nil:
+		r.err = r.problem(err)
+		return n, r.err
+	}
+	return n, err
+}
+
+// problem explains an error reading a blob: errors reading the bytes as
+// stored are passed on, and anything else means they are corrupt.
+func (r *blobReader) problem(err error) error {
+	switch {
+	case r.stored.err != nil:
+		return fmt.Errorf("failed to read blob %s: %w", r.blob.Hash, err)
+	case errors.Is(err, envelope.ErrDecrypt):
+		return fmt.Errorf("failed to decrypt blob %s: %v: %w", r.blob.Hash, err, domain.ErrCorrupt)
+	default:
+		return fmt.Errorf("failed to decompress blob %s: %v: %w", r.blob.Hash, err, domain.ErrCorrupt)
+	}
+}
+
+func (r *blobReader) verify() error {
+	// The decompressor may stop short of the end of what was stored.
+	if _, err := io.Copy(io.Discard, r.stored); err != nil {
+		return fmt.Errorf("failed to read blob %s: %w", r.blob.Hash, err)
+	}
+	if r.blob.Checksum != "" && r.stored.sum() != r.blob.Checksum {
+		return checksumMismatch(r.blob)
+	}
+	if r.content != nil && hex.EncodeToString(r.content.Sum(nil)) != r.blob.Hash {
+		return fmt.Errorf("blob %s does not match its content hash: %w", r.blob.Hash, domain.ErrCorrupt)
+	}
+	return nil
+}
+
+// checksum is the checksum of the bytes as stored, once read to the end.
+func (r *blobReader) checksum() string {
+	return r.stored.sum()
+}
+
+func (r *blobReader) Close() error {
+	r.data.Close()
+	return r.body.Close()
+}
+
+// Problems reported by Scrub.
+const (
+	ScrubMissing    = "missing"
+	ScrubUnreadable = "unreadable"
+	ScrubCorrupted  = "corrupted"
+	// ScrubUnverified is an encrypted blob without a recorded checksum,
+	// which cannot be checked without its key.
+	ScrubUnverified = "unverified"
+)
+
+// ScrubProblem is a blob that failed its checks, with the keys of the
+// artboards and versions that point at it.
+type ScrubProblem struct {
+	Blob *domain.Blob
+	Kind string
+	Refs []string
+	Err  error
+}
+
+// Scrub reads every stored blob and checks it against its checksum and,
+// when unencrypted, its content hash, calling report for each one with a
+// problem. With backfill, unencrypted blobs saved before checksums were
+// recorded get one once their content checks out. It returns how many
+// blobs it checked.
+func Scrub(blobs domain.BlobStore, blobRepo domain.BlobRepository, backfill bool, report func(problem *ScrubProblem)) (int, error) {
+	checked := 0
+	after := ""
+	for {
+		batch, err := blobRepo.List(after, gcBatchSize)
+		if err != nil {
+			return checked, fmt.Errorf("failed to list blobs: %w", err)
+		}
+		for _, blob := range batch {
+			sum, kind, problem := scrubBlob(blobs, blob)
+			checked++
+			after = blob.Hash
+
+			if kind == "" {
+				if backfill && blob.Checksum == "" {
+					blob.Checksum = sum
+					if err := blobRepo.UpdateStored(blob); err != nil {
+						return checked, fmt.Errorf("failed to record checksum of %s: %w", blob.Hash, err)
+					}
+				}
+				continue
+			}
+			refs, err := blobRepo.ListRefs(blob.Hash)
+			if err != nil {
+				return checked, fmt.Errorf("failed to list references to %s: %w", blob.Hash, err)
+			}
+			report(&ScrubProblem{Blob: blob, Kind: kind, Refs: refs, Err: problem})
+		}
+		if len(batch) < gcBatchSize {
+			return checked, nil
+		}
+	}
+}
+
+// scrubBlob checks one blob and returns the checksum of its bytes as
+// stored, or the kind of problem it has.
+func scrubBlob(blobs domain.BlobStore, blob *domain.Blob) (string, string, error) {
+	body, err := blobs.Get(blobKey(blob.Hash))
+	if errors.Is(err, domain.ErrNotFound) {
+		return "", ScrubMissing, err
+	}
+	if err != nil {
+		return "", ScrubUnreadable, err
+	}
+
+	if blob.KeyID != "" {
+		// Without keys only the bytes as stored can be checked.
+		defer body.Close()
+		stored := sha256.New()
+		if _, err := io.Copy(stored, body); err != nil {
+			return "", ScrubUnreadable, err
+		}
+		sum := hex.EncodeToString(stored.Sum(nil))
+		switch blob.Checksum {
+		case "":
+			return "", ScrubUnverified, nil
+		case sum:
+			return sum, "", nil
+		default:
+			return "", ScrubCorrupted, checksumMismatch(blob)
+		}
+	}
+
+	data, err := openBlob(blob, nil, body)
+	if err == nil {
+		_, err = io.Copy(io.Discard, data)
+		data.Close()
+	}
+	switch {
+	case errors.Is(err, domain.ErrCorrupt):
+		return "", ScrubCorrupted, err
+	case err != nil:
+		return "", ScrubUnreadable, err
+	}
+	return data.checksum(), "", nil
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"testing"
+
+	"goP2Pbackend/internal/domain"
+)
+
+// damage replaces the bytes kept for a blob with what change makes of them.
+func (s *testStorage) damage(t *testing.T, hash string, change func(stored []byte) []byte) {
+	t.Helper()
+	stored := s.stored(t, hash)
+	if err := s.blobs.Put(blobKey(hash), bytes.NewReader(change(stored)), ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func flipByte(at int) func([]byte) []byte {
+	return func(stored []byte) []byte {
+		damaged := append([]byte(nil), stored...)
+		if at < 0 {
+			at += len(damaged)
+		}
+		damaged[at] ^= 0x40
+		return damaged
+	}
+}
+
+func TestLoadDetectsCorruption(t *testing.T) {
+	data := testData(200 << 10)
+	for _, tc := range []struct {
+		name      string
+		encoding  string
+		encrypted bool
+		// noChecksum forgets the checksum, as for blobs saved before
+		// checksums were recorded, so only the content hash is left.
+		noChecksum bool
+		change     func([]byte) []byte
+	}{
+		{"flipped byte", EncodingNone, false, false, flipByte(1000)},
+		{"flipped byte without checksum", EncodingNone, false, true, flipByte(1000)},
+		{"flipped last byte", EncodingNone, false, false, flipByte(-1)},
+		{"trailing garbage", EncodingNone, false, false, func(b []byte) []byte { return append(b, "junk"...) }},
+		{"flipped gzip byte", EncodingGzip, false, false, flipByte(100)},
+		{"flipped gzip byte without checksum", EncodingGzip, false, true, flipByte(100)},
+		{"gzip trailer", EncodingGzip, false, false, flipByte(-2)},
+		{"flipped zstd byte", EncodingZstd, false, false, flipByte(100)},
+		{"flipped encrypted byte", EncodingZstd, true, false, flipByte(100)},
+		{"flipped encrypted byte without checksum", EncodingGzip, true, true, flipByte(-1)},
+		{"truncated encrypted", EncodingNone, true, false, func(b []byte) []byte { return b[:len(b)-100] }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestStorage(t, tc.encoding, tc.encrypted)
+			if err := s.Save("board", data); err != nil {
+				t.Fatal(err)
+			}
+			blob := s.resolve(t, artboardRef("board"))
+			if tc.noChecksum {
+				blob.Checksum = ""
+				s.blobRepo.UpdateStored(blob)
+			}
+			s.damage(t, blob.Hash, tc.change)
+
+			if _, err := s.Load("board"); !errors.Is(err, domain.ErrCorrupt) {
+				t.Fatalf("Load = %v, want ErrCorrupt", err)
+			}
+			if err := s.LoadTo("board", io.Discard); !errors.Is(err, domain.ErrCorrupt) {
+				t.Fatalf("LoadTo = %v, want ErrCorrupt", err)
+			}
+		})
+	}
+}
+
+// TestBlobReaderFailsTheLastRead checks that data whose damage only shows
+// at the end is returned in full before the read that would have ended it
+// fails, so that a stream can be cut short rather than end cleanly.
+func TestBlobReaderFailsTheLastRead(t *testing.T) {
+	data := testData(10 << 10)
+	s := newTestStorage(t, EncodingNone, false)
+	if err := s.Save("board", data); err != nil {
+		t.Fatal(err)
+	}
+	blob := s.resolve(t, artboardRef("board"))
+	s.damage(t, blob.Hash, flipByte(len(data)/2))
+
+	body, err := s.blobs.Get(blobKey(blob.Hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := openBlob(blob, nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	read := 0
+	buf := make([]byte, 1000)
+	for {
+		n, err := r.Read(buf)
+		read += n
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, domain.ErrCorrupt) {
+			t.Fatalf("read ended with %v, want ErrCorrupt", err)
+		}
+		break
+	}
+	if read != len(data) {
+		t.Fatalf("read %d bytes before ErrCorrupt, want all %d", read, len(data))
+	}
+	if _, err := r.Read(buf); !errors.Is(err, domain.ErrCorrupt) {
+		t.Fatalf("read after failing = %v, want ErrCorrupt again", err)
+	}
+}
+
+func TestScrubReportsAndBackfills(t *testing.T) {
+	plain := newTestStorage(t, EncodingGzip, false)
+	saves := map[string][]byte{"ok": testData(1000), "corrupted": testData(1001), "missing": testData(1002), "legacy": testData(1003)}
+	for artboardID, data := range saves {
+		if err := plain.Save(artboardID, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := plain.SaveVersion("corrupted", "v1", saves["corrupted"]); err != nil {
+		t.Fatal(err)
+	}
+	blobs := make(map[string]*domain.Blob)
+	for artboardID := range saves {
+		blobs[artboardID] = plain.resolve(t, artboardRef(artboardID))
+	}
+	plain.damage(t, blobs["corrupted"].Hash, flipByte(50))
+	plain.blobs.Delete(blobKey(blobs["missing"].Hash))
+	legacyChecksum := blobs["legacy"].Checksum
+	blobs["legacy"].Checksum = ""
+	plain.blobRepo.UpdateStored(blobs["legacy"])
+
+	for _, backfill := range []bool{false, true} {
+		t.Run(fmt.Sprintf("backfill=%v", backfill), func(t *testing.T) {
+			found := make(map[string]*ScrubProblem)
+			checked, err := Scrub(plain.blobs, plain.blobRepo, backfill, func(problem *ScrubProblem) {
+				found[problem.Blob.Hash] = problem
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if checked != len(saves) {
+				t.Fatalf("checked %d blobs, want %d", checked, len(saves))
+			}
+			if len(found) != 2 {
+				t.Fatalf("reported %d problems, want 2", len(found))
+			}
+			corrupted := found[blobs["corrupted"].Hash]
+			if corrupted == nil || corrupted.Kind != ScrubCorrupted || !errors.Is(corrupted.Err, domain.ErrCorrupt) {
+				t.Fatalf("corrupted blob reported as %+v", corrupted)
+			}
+			if want := []string{artboardRef("corrupted"), versionRef("corrupted", "v1")}; fmt.Sprint(corrupted.Refs) != fmt.Sprint(want) {
+				t.Fatalf("corrupted blob referenced by %v, want %v", corrupted.Refs, want)
+			}
+			if missing := found[blobs["missing"].Hash]; missing == nil || missing.Kind != ScrubMissing {
+				t.Fatalf("missing blob reported as %+v", missing)
+			}
+
+			legacy, _ := plain.blobRepo.Get(blobs["legacy"].Hash)
+			want := ""
+			if backfill {
+				want = legacyChecksum
+			}
+			if legacy.Checksum != want {
+				t.Fatalf("legacy checksum = %q, want %q", legacy.Checksum, want)
+			}
+		})
+	}
+}
+
+func TestScrubChecksEncryptedBlobsWithoutKeys(t *testing.T) {
+	s := newTestStorage(t, EncodingZstd, true)
+	for _, artboardID := range []string{"ok", "corrupted", "unverified"} {
+		if err := s.Save(artboardID, testData(70<<10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	corrupted := s.resolve(t, artboardRef("corrupted"))
+	s.damage(t, corrupted.Hash, flipByte(-1))
+	unverified := s.resolve(t, artboardRef("unverified"))
+	unverified.Checksum = ""
+	s.blobRepo.UpdateStored(unverified)
+
+	var kinds []string
+	_, err := Scrub(s.blobs, s.blobRepo, true, func(problem *ScrubProblem) {
+		kinds = append(kinds, problem.Kind)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(kinds)
+	if want := []string{ScrubCorrupted, ScrubUnverified}; fmt.Sprint(kinds) != fmt.Sprint(want) {
+		t.Fatalf("reported %v, want %v", kinds, want)
+	}
+	// Encrypted blobs are not backfilled: their content cannot be checked.
+	if after, _ := s.blobRepo.Get(unverified.Hash); after.Checksum != "" {
+		t.Fatal("checksum backfilled for an encrypted blob")
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// spool holds data between the passes of a save, since content-addressed
+// data cannot be stored before all of it has been read and hashed.
+type spool interface {
+	io.Writer
+	// reader reads back everything written. It is a file or other
+	// io.ReaderAt, so that S3 can upload parts of it without copies.
+	reader() (io.Reader, error)
+	size() int64
+	// remove discards the data.
+	remove() error
+}
+
+// newSpool creates a spool.
+type newSpool func() (spool, error)
+
+// memorySpool spools data that is in memory anyway.
+type memorySpool struct {
+	bytes.Buffer
+}
+
+func newMemorySpool() (spool, error) {
+	return &memorySpool{}, nil
+}
+
+func (s *memorySpool) reader() (io.Reader, error) {
+	return bytes.NewReader(s.Bytes()), nil
+}
+
+func (s *memorySpool) size() int64 {
+	return int64(s.Len())
+}
+
+func (s *memorySpool) remove() error {
+	s.Reset()
+	return nil
+}
+
+// fileSpool spools streams to a temporary file, in the directory named by
+// $TMPDIR unless it is unset.
+type fileSpool struct {
+	file    *os.File
+	written int64
+}
+
+func newFileSpool() (spool, error) {
+	file, err := os.CreateTemp("", "artboard-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	return &fileSpool{file: file}, nil
+}
+
+func (s *fileSpool) Write(p []byte) (int, error) {
+	n, err := s.file.Write(p)
+	s.written += int64(n)
+	return n, err
+}
+
+func (s *fileSpool) reader() (io.Reader, error) {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind spool file: %w", err)
+	}
+	return s.file, nil
+}
+
+func (s *fileSpool) size() int64 {
+	return s.written
+}
+
+func (s *fileSpool) remove() error {
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
@@ -1,66 +1,152 @@
-package usecase
-
-import (
-	"goP2Pbackend/internal/domain"
-
-	"github.com/google/uuid"
-)
-
-type artboardUsecase struct {
-	artboardRepo    domain.ArtboardRepository
-	artboardStorage domain.ArtboardStorage
-}
-
-func NewArtboardUsecase(ar domain.ArtboardRepository, as domain.ArtboardStorage) domain.ArtboardUsecase {
-	return &artboardUsecase{
-		artboardRepo:    ar,
-		artboardStorage: as,
-	}
-}
-
-func (a *artboardUsecase) Create(artboard *domain.Artboard) error {
-	artboard.ID = uuid.New().String()
-	artboard.ShareableID = uuid.New().String()
-	return a.artboardRepo.Create(artboard)
-}
-
-func (a *artboardUsecase) GetByID(id string) (*domain.Artboard, error) {
-	return a.artboardRepo.GetByID(id)
-}
-
-func (a *artboardUsecase) GetByOwnerID(ownerID string) ([]*domain.Artboard, error) {
-	return a.artboardRepo.GetByOwnerID(ownerID)
-}
-
-func (a *artboardUsecase) Update(artboard *domain.Artboard) error {
-	return a.artboardRepo.Update(artboard)
-}
-
-func (a *artboardUsecase) Delete(id string) error {
-	return a.artboardRepo.Delete(id)
-}
-
-func (a *artboardUsecase) GenerateShareableLink(artboardID string, isReadOnly bool) (string, error) {
-	artboard, err := a.artboardRepo.GetByID(artboardID)
-	if err != nil {
-		return "", err
-	}
-
-	artboard.IsReadOnly = isReadOnly
-	artboard.ShareableID = uuid.New().String()
-
-	err = a.artboardRepo.Update(artboard)
-	if err != nil {
-		return "", err
-	}
-
-	return artboard.ShareableID, nil
-}
-
-func (a *artboardUsecase) SaveArtboardData(artboardID string, data []byte) error {
-	return a.artboardStorage.Save(artboardID, data)
-}
-
-func (a *artboardUsecase) LoadArtboardData(artboardID string) ([]byte, error) {
-	return a.artboardStorage.Load(artboardID)
-}
+package usecase
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/board"
+
+	"github.com/google/uuid"
+)
+
+type artboardUsecase struct {
+	artboardRepo    domain.ArtboardRepository
+	artboardStorage domain.ArtboardStorage
+	versionRepo     domain.VersionRepository
+	operationRepo   domain.OperationRepository
+	memberRepo      domain.MemberRepository
+	memberUsecase   domain.MemberUsecase
+	notifier        domain.Notifier
+	submitter       domain.OperationSubmitter
+}
+
+func NewArtboardUsecase(ar domain.ArtboardRepository, as domain.ArtboardStorage, vr domain.VersionRepository, or domain.OperationRepository, mr domain.MemberRepository, mu domain.MemberUsecase, n domain.Notifier, s domain.OperationSubmitter) domain.ArtboardUsecase {
+	return &artboardUsecase{
+		artboardRepo:    ar,
+		artboardStorage: as,
+		versionRepo:     vr,
+		operationRepo:   or,
+		memberRepo:      mr,
+		memberUsecase:   mu,
+		notifier:        n,
+		submitter:       s,
+	}
+}
+
+func (a *artboardUsecase) Create(artboard *domain.Artboard) error {
+	artboard.ID = uuid.New().String()
+	artboard.ShareableID = uuid.New().String()
+	return a.artboardRepo.Create(artboard)
+}
+
+func (a *artboardUsecase) GetByID(id string) (*domain.Artboard, error) {
+	return a.artboardRepo.GetByID(id)
+}
+
+func (a *artboardUsecase) GetByOwnerID(ownerID string) ([]*domain.Artboard, error) {
+	return a.artboardRepo.GetByOwnerID(ownerID)
+}
+
+func (a *artboardUsecase) Update(artboard *domain.Artboard) error {
+	return a.artboardRepo.Update(artboard)
+}
+
+func (a *artboardUsecase) Delete(id string) error {
+	if err := a.artboardRepo.Delete(id); err != nil {
+		return err
+	}
+	return a.artboardStorage.Delete(id)
+}
+
+func (a *artboardUsecase) GenerateShareableLink(artboardID string, isReadOnly bool) (string, error) {
+	artboard, err := a.artboardRepo.GetByID(artboardID)
+	if err != nil {
+		return "", err
+	}
+
+	artboard.IsReadOnly = isReadOnly
+	artboard.ShareableID = uuid.New().String()
+
+	err = a.artboardRepo.Update(artboard)
+	if err != nil {
+		return "", err
+	}
+
+	a.notifyShare(artboard)
+	return artboard.ShareableID, nil
+}
+
+// notifyShare tells the artboard's members that its link changed. Users who
+// joined through an old link lose access (see MemberUsecase.Role).
+func (a *artboardUsecase) notifyShare(artboard *domain.Artboard) {
+	if a.notifier == nil {
+		return
+	}
+	members, err := a.memberRepo.ListByArtboard(artboard.ID)
+	if err != nil {
+		log.Printf("Error listing members of %s: %v", artboard.ID, err)
+		return
+	}
+	for _, member := range members {
+		err := a.notifier.Notify(member.UserID, domain.NotificationShare, map[string]interface{}{
+			"artboard_id":  artboard.ID,
+			"name":         artboard.Name,
+			"is_read_only": artboard.IsReadOnly,
+		})
+		if err != nil {
+			log.Printf("Error notifying %s of share: %v", member.UserID, err)
+		}
+	}
+}
+
+func (a *artboardUsecase) SaveArtboardData(artboardID string, data []byte) error {
+	return a.artboardStorage.Save(artboardID, data)
+}
+
+func (a *artboardUsecase) LoadArtboardData(artboardID string) ([]byte, error) {
+	return a.artboardStorage.Load(artboardID)
+}
+
+// StreamArtboardData writes the board as it is now, from its latest
+// version and the operations logged since, the way its room loads it.
+func (a *artboardUsecase) StreamArtboardData(artboardID, userID string, w io.Writer) error {
+	if _, err := a.memberUsecase.Role(artboardID, userID); err != nil {
+		return err
+	}
+	doc, _, err := loadHead(a.versionRepo, a.operationRepo, a.artboardStorage, artboardID)
+	if err != nil {
+		return err
+	}
+	data, err := doc.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ReplaceArtboardData turns the live board into the document read from r
+// through its room, so connected clients see the change and it is logged
+// like any other.
+func (a *artboardUsecase) ReplaceArtboardData(artboardID, userID string, r io.Reader) error {
+	role, err := a.memberUsecase.Role(artboardID, userID)
+	if err != nil {
+		return err
+	}
+	if !role.CanEdit() {
+		return domain.ErrForbidden
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if _, err := board.Parse(data); err != nil {
+		return fmt.Errorf("%v: %w", err, domain.ErrInvalid)
+	}
+	if _, _, err := a.submitter.Patch(artboardID, userID, nil, data); err != nil {
+		return fmt.Errorf("failed to apply artboard data: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package usecase
+
+import (
+	"fmt"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/board"
+
+	"github.com/google/uuid"
+)
+
+type branchUsecase struct {
+	branchRepo      domain.BranchRepository
+	versionRepo     domain.VersionRepository
+	operationRepo   domain.OperationRepository
+	artboardStorage domain.ArtboardStorage
+	artboardUsecase domain.ArtboardUsecase
+	memberUsecase   domain.MemberUsecase
+	submitter       domain.OperationSubmitter
+}
+
+func NewBranchUsecase(br domain.BranchRepository, vr domain.VersionRepository, or domain.OperationRepository, as domain.ArtboardStorage, au domain.ArtboardUsecase, mu domain.MemberUsecase, s domain.OperationSubmitter) domain.BranchUsecase {
+	return &branchUsecase{
+		branchRepo:      br,
+		versionRepo:     vr,
+		operationRepo:   or,
+		artboardStorage: as,
+		artboardUsecase: au,
+		memberUsecase:   mu,
+		submitter:       s,
+	}
+}
+
+func (b *branchUsecase) requireRole(artboardID, userID string, edit bool) error {
+	role, err := b.memberUsecase.Role(artboardID, userID)
+	if err != nil {
+		return err
+	}
+	if edit && !role.CanEdit() {
+		return domain.ErrForbidden
+	}
+	return nil
+}
+
+// checkpoint saves an unnamed version of a document.
+func (b *branchUsecase) checkpoint(artboardID string, seq int64, doc *board.Document) (*domain.Version, error) {
+	data, err := doc.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	version := &domain.Version{
+		ID:         uuid.New().String(),
+		ArtboardID: artboardID,
+		Seq:        seq,
+		CreatedAt:  time.Now(),
+	}
+	if err := saveVersion(b.versionRepo, b.artboardStorage, version, data); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+func (b *branchUsecase) Fork(artboardID, userID, name string) (*domain.Artboard, *domain.Branch, error) {
+	if name == "" {
+		return nil, nil, fmt.Errorf("a branch needs a name: %w", domain.ErrInvalid)
+	}
+	if err := b.requireRole(artboardID, userID, false); err != nil {
+		return nil, nil, err
+	}
+
+	doc, seq, err := loadHead(b.versionRepo, b.operationRepo, b.artboardStorage, artboardID)
+	if err != nil {
+		return nil, nil, err
+	}
+	base, err := b.checkpoint(artboardID, seq, doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	artboard := &domain.Artboard{
+		Name:      name,
+		OwnerID:   userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := b.artboardUsecase.Create(artboard); err != nil {
+		return nil, nil, fmt.Errorf("failed to create branch: %w", err)
+	}
+	data, err := doc.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, _, err := b.submitter.Patch(artboard.ID, userID, nil, data); err != nil {
+		return nil, nil, fmt.Errorf("failed to copy artboard: %w", err)
+	}
+
+	branch := &domain.Branch{
+		ArtboardID:    artboard.ID,
+		ParentID:      artboardID,
+		BaseVersionID: base.ID,
+		CreatedBy:     userID,
+		CreatedAt:     now,
+	}
+	if err := b.branchRepo.Create(branch); err != nil {
+		return nil, nil, fmt.Errorf("failed to save branch: %w", err)
+	}
+	return artboard, branch, nil
+}
+
+func (b *branchUsecase) List(artboardID, userID string) ([]*domain.Branch, error) {
+	if err := b.requireRole(artboardID, userID, false); err != nil {
+		return nil, err
+	}
+	return b.branchRepo.ListByParent(artboardID)
+}
+
+// mergeState is everything a merge is computed from.
+type mergeState struct {
+	branch     *domain.Branch
+	parent     *board.Document
+	parentSeq  int64
+	theirs     *board.Document
+	theirsSeq  int64
+	merged     *board.Document
+	unresolved []*domain.MergeConflict
+}
+
+// prepare computes the merge of a branch into its parent, settling the
+// conflicts that have a resolution.
+func (b *branchUsecase) prepare(branchID, userID string, edit bool, resolutions map[string]*domain.MergeResolution) (*mergeState, error) {
+	branch, err := b.branchRepo.GetByArtboard(branchID)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.requireRole(branchID, userID, false); err != nil {
+		return nil, err
+	}
+	if err := b.requireRole(branch.ParentID, userID, edit); err != nil {
+		return nil, err
+	}
+
+	baseVersion, err := b.versionRepo.GetByID(branch.BaseVersionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load base version: %w", err)
+	}
+	data, err := b.artboardStorage.LoadVersion(baseVersion.ArtboardID, baseVersion.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load version %s: %w", baseVersion.ID, err)
+	}
+	base, err := board.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &mergeState{branch: branch}
+	if state.parent, state.parentSeq, err = loadHead(b.versionRepo, b.operationRepo, b.artboardStorage, branch.ParentID); err != nil {
+		return nil, err
+	}
+	if state.theirs, state.theirsSeq, err = loadHead(b.versionRepo, b.operationRepo, b.artboardStorage, branchID); err != nil {
+		return nil, err
+	}
+
+	merged, conflicts := board.Merge(base, state.parent, state.theirs)
+	for _, conflict := range conflicts {
+		resolution, ok := resolutions[conflict.ID]
+		if !ok {
+			state.unresolved = append(state.unresolved, &domain.MergeConflict{
+				ID:     conflict.ID,
+				Base:   conflict.Base,
+				Parent: conflict.Ours,
+				Branch: conflict.Theirs,
+			})
+			continue
+		}
+
+		var object []byte
+		switch {
+		case resolution.Object != nil:
+			if id, err := board.ObjectID(resolution.Object); err != nil || id != conflict.ID {
+				return nil, fmt.Errorf("resolution of %s must be an object with that id: %w", conflict.ID, domain.ErrInvalid)
+			}
+			object = resolution.Object
+		case resolution.Take == domain.TakeParent:
+			object = conflict.Ours
+		case resolution.Take == domain.TakeBranch:
+			object = conflict.Theirs
+		default:
+			return nil, fmt.Errorf("resolution of %s must take parent or branch, or give an object: %w", conflict.ID, domain.ErrInvalid)
+		}
+		if object == nil {
+			delete(merged.Objects, conflict.ID)
+		} else {
+			merged.Objects[conflict.ID] = object
+		}
+	}
+	state.merged = merged
+	return state, nil
+}
+
+func (s *mergeState) result() *domain.MergeResult {
+	diff := board.Compare(s.parent, s.merged)
+	result := &domain.MergeResult{
+		Added:     diff.Added,
+		Removed:   diff.Removed,
+		Modified:  diff.Modified,
+		Conflicts: s.unresolved,
+	}
+	if result.Conflicts == nil {
+		result.Conflicts = []*domain.MergeConflict{}
+	}
+	return result
+}
+
+func (b *branchUsecase) Preview(branchID, userID string) (*domain.MergeResult, error) {
+	state, err := b.prepare(branchID, userID, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return state.result(), nil
+}
+
+func (b *branchUsecase) Merge(branchID, userID string, resolutions map[string]*domain.MergeResolution) (*domain.MergeResult, error) {
+	state, err := b.prepare(branchID, userID, true, resolutions)
+	if err != nil {
+		return nil, err
+	}
+	result := state.result()
+	if len(result.Conflicts) > 0 {
+		return result, nil
+	}
+
+	artboard, err := b.artboardUsecase.GetByID(branchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load branch: %w", err)
+	}
+	parent, err := state.parent.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	merged, err := state.merged.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	// Only what the merge changes is applied, on top of whatever happened
+	// to the parent since it was loaded.
+	data, seq, err := b.submitter.Patch(state.branch.ParentID, userID, parent, merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply merge: %w", err)
+	}
+	version := &domain.Version{
+		ID:         uuid.New().String(),
+		ArtboardID: state.branch.ParentID,
+		Seq:        seq,
+		Name:       "Merged " + artboard.Name,
+		CreatedBy:  userID,
+		CreatedAt:  time.Now(),
+	}
+	if err := saveVersion(b.versionRepo, b.artboardStorage, version, data); err != nil {
+		return nil, err
+	}
+	result.Version = version
+
+	// The parent now has everything the branch had, so the branch as it is
+	// becomes the base of the next merge.
+	base, err := b.checkpoint(branchID, state.theirsSeq, state.theirs)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	state.branch.BaseVersionID = base.ID
+	state.branch.MergedAt = &now
+	if err := b.branchRepo.Update(state.branch); err != nil {
+		return nil, fmt.Errorf("failed to update branch: %w", err)
+	}
+	return result, nil
+}
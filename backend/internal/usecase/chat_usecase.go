@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// MaxChatMessageLength caps a chat message, in bytes.
+const MaxChatMessageLength = 4000
+
+type chatUsecase struct {
+	chatRepo      domain.ChatRepository
+	memberUsecase domain.MemberUsecase
+}
+
+func NewChatUsecase(cr domain.ChatRepository, mu domain.MemberUsecase) domain.ChatUsecase {
+	return &chatUsecase{
+		chatRepo:      cr,
+		memberUsecase: mu,
+	}
+}
+
+func validateChatBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || len(body) > MaxChatMessageLength {
+		return "", fmt.Errorf("chat message must be 1 to %d bytes: %w", MaxChatMessageLength, domain.ErrInvalid)
+	}
+	return body, nil
+}
+
+func (c *chatUsecase) Post(artboardID, authorID, body string) (*domain.ChatMessage, error) {
+	body, err := validateChatBody(body)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.memberUsecase.Role(artboardID, authorID); err != nil {
+		return nil, err
+	}
+	message := &domain.ChatMessage{
+		ID:         uuid.New().String(),
+		ArtboardID: artboardID,
+		AuthorID:   authorID,
+		Body:       body,
+		CreatedAt:  time.Now(),
+	}
+	if err := c.chatRepo.Create(message); err != nil {
+		return nil, fmt.Errorf("failed to save chat message: %w", err)
+	}
+	return message, nil
+}
+
+// own loads a live message on artboardID and checks that userID wrote it.
+func (c *chatUsecase) own(artboardID, id, userID string) (*domain.ChatMessage, error) {
+	if _, err := c.memberUsecase.Role(artboardID, userID); err != nil {
+		return nil, err
+	}
+	message, err := c.chatRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if message.ArtboardID != artboardID || message.DeletedAt != nil {
+		return nil, domain.ErrNotFound
+	}
+	if message.AuthorID != userID {
+		return nil, domain.ErrForbidden
+	}
+	return message, nil
+}
+
+func (c *chatUsecase) Edit(artboardID, id, userID, body string) (*domain.ChatMessage, error) {
+	body, err := validateChatBody(body)
+	if err != nil {
+		return nil, err
+	}
+	message, err := c.own(artboardID, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	message.Body = body
+	message.EditedAt = &now
+	if err := c.chatRepo.Update(message); err != nil {
+		return nil, fmt.Errorf("failed to update chat message: %w", err)
+	}
+	return message, nil
+}
+
+func (c *chatUsecase) Delete(artboardID, id, userID string) (*domain.ChatMessage, error) {
+	message, err := c.own(artboardID, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	message.Body = ""
+	message.DeletedAt = &now
+	if err := c.chatRepo.Update(message); err != nil {
+		return nil, fmt.Errorf("failed to delete chat message: %w", err)
+	}
+	return message, nil
+}
+
+func (c *chatUsecase) List(artboardID, userID, before string, limit int) ([]*domain.ChatMessage, error) {
+	if _, err := c.memberUsecase.Role(artboardID, userID); err != nil {
+		return nil, err
+	}
+	return c.chatRepo.ListByArtboard(artboardID, before, limit)
+}
+
+func (c *chatUsecase) MarkRead(artboardID, userID string) error {
+	if _, err := c.memberUsecase.Role(artboardID, userID); err != nil {
+		return err
+	}
+	return c.chatRepo.MarkRead(artboardID, userID, time.Now())
+}
+
+func (c *chatUsecase) CountUnread(artboardID, userID string) (int, error) {
+	if _, err := c.memberUsecase.Role(artboardID, userID); err != nil {
+		return 0, err
+	}
+	return c.chatRepo.CountUnread(artboardID, userID)
+}
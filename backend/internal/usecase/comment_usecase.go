@@ -0,0 +1,263 @@
+package usecase
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// MaxCommentLength caps a comment, in bytes.
+const MaxCommentLength = 10000
+
+type commentUsecase struct {
+	commentRepo   domain.CommentRepository
+	memberUsecase domain.MemberUsecase
+	notifier      domain.Notifier
+}
+
+func NewCommentUsecase(cr domain.CommentRepository, mu domain.MemberUsecase, n domain.Notifier) domain.CommentUsecase {
+	return &commentUsecase{
+		commentRepo:   cr,
+		memberUsecase: mu,
+		notifier:      n,
+	}
+}
+
+func validateCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || len(body) > MaxCommentLength {
+		return "", fmt.Errorf("comment must be 1 to %d bytes: %w", MaxCommentLength, domain.ErrInvalid)
+	}
+	return body, nil
+}
+
+// requireCommenter fails with ErrForbidden unless userID may comment.
+func (c *commentUsecase) requireCommenter(artboardID, userID string) (domain.Role, error) {
+	role, err := c.memberUsecase.Role(artboardID, userID)
+	if err != nil {
+		return "", err
+	}
+	if !role.CanComment() {
+		return "", domain.ErrForbidden
+	}
+	return role, nil
+}
+
+// thread loads the first comment of a thread on artboardID.
+func (c *commentUsecase) thread(artboardID, threadID string) (*domain.Comment, error) {
+	root, err := c.commentRepo.GetByID(threadID)
+	if err != nil {
+		return nil, err
+	}
+	if root.ArtboardID != artboardID || !root.IsThread() {
+		return nil, domain.ErrNotFound
+	}
+	return root, nil
+}
+
+func (c *commentUsecase) Create(artboardID, authorID, threadID, body string, anchor *domain.Anchor, mentions []string) (*domain.Comment, error) {
+	body, err := validateCommentBody(body)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.requireCommenter(artboardID, authorID); err != nil {
+		return nil, err
+	}
+
+	comment := &domain.Comment{
+		ID:         uuid.New().String(),
+		ArtboardID: artboardID,
+		AuthorID:   authorID,
+		Body:       body,
+		Mentions:   uniqueMentions(mentions, authorID),
+		CreatedAt:  time.Now(),
+	}
+	if threadID != "" {
+		if _, err := c.thread(artboardID, threadID); err != nil {
+			return nil, err
+		}
+		comment.ThreadID = threadID
+	} else {
+		if anchor == nil {
+			return nil, fmt.Errorf("a new thread needs an anchor: %w", domain.ErrInvalid)
+		}
+		comment.ThreadID = comment.ID
+		comment.Anchor = anchor
+	}
+
+	if err := c.commentRepo.Create(comment); err != nil {
+		return nil, fmt.Errorf("failed to save comment: %w", err)
+	}
+	c.notifyMentions(comment, comment.Mentions)
+	if threadID != "" {
+		c.notifyReply(comment)
+	}
+	return comment, nil
+}
+
+func (c *commentUsecase) Edit(artboardID, id, userID, body string, mentions []string) (*domain.Comment, error) {
+	body, err := validateCommentBody(body)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.requireCommenter(artboardID, userID); err != nil {
+		return nil, err
+	}
+	comment, err := c.commentRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if comment.ArtboardID != artboardID {
+		return nil, domain.ErrNotFound
+	}
+	if comment.AuthorID != userID {
+		return nil, domain.ErrForbidden
+	}
+
+	previous := make(map[string]bool, len(comment.Mentions))
+	for _, id := range comment.Mentions {
+		previous[id] = true
+	}
+	now := time.Now()
+	comment.Body = body
+	comment.Mentions = uniqueMentions(mentions, userID)
+	comment.EditedAt = &now
+	if err := c.commentRepo.Update(comment); err != nil {
+		return nil, fmt.Errorf("failed to update comment: %w", err)
+	}
+
+	var added []string
+	for _, id := range comment.Mentions {
+		if !previous[id] {
+			added = append(added, id)
+		}
+	}
+	c.notifyMentions(comment, added)
+	return comment, nil
+}
+
+// Delete removes a comment, or a whole thread when given its first
+// comment. Authors may delete their own comments, owners any comment.
+func (c *commentUsecase) Delete(artboardID, id, userID string) (*domain.Comment, error) {
+	role, err := c.memberUsecase.Role(artboardID, userID)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := c.commentRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if comment.ArtboardID != artboardID {
+		return nil, domain.ErrNotFound
+	}
+	if comment.AuthorID != userID && role != domain.RoleOwner {
+		return nil, domain.ErrForbidden
+	}
+	if err := c.commentRepo.Delete(id); err != nil {
+		return nil, fmt.Errorf("failed to delete comment: %w", err)
+	}
+	return comment, nil
+}
+
+func (c *commentUsecase) SetResolved(artboardID, threadID, userID string, resolved bool) (*domain.Comment, error) {
+	if _, err := c.requireCommenter(artboardID, userID); err != nil {
+		return nil, err
+	}
+	root, err := c.thread(artboardID, threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	root.Resolved = resolved
+	if resolved {
+		now := time.Now()
+		root.ResolvedBy = userID
+		root.ResolvedAt = &now
+	} else {
+		root.ResolvedBy = ""
+		root.ResolvedAt = nil
+	}
+	if err := c.commentRepo.Update(root); err != nil {
+		return nil, fmt.Errorf("failed to update thread: %w", err)
+	}
+	return root, nil
+}
+
+func (c *commentUsecase) List(artboardID, userID string, includeResolved bool) ([]*domain.Comment, error) {
+	if _, err := c.memberUsecase.Role(artboardID, userID); err != nil {
+		return nil, err
+	}
+	return c.commentRepo.ListByArtboard(artboardID, includeResolved)
+}
+
+// notifyMentions tells each mentioned user who owns or is a member of the
+// board about the comment; anyone else could at best reach it through its
+// link, and mentions must not leak boards to them. Failures are logged;
+// the comment itself is already saved.
+func (c *commentUsecase) notifyMentions(comment *domain.Comment, userIDs []string) {
+	if c.notifier == nil {
+		return
+	}
+	for _, userID := range userIDs {
+		member, err := c.memberUsecase.IsMember(comment.ArtboardID, userID)
+		if err != nil {
+			log.Printf("Error checking membership of %s: %v", userID, err)
+			continue
+		}
+		if !member {
+			continue
+		}
+		if err := c.notifier.Notify(userID, domain.NotificationMention, comment); err != nil {
+			log.Printf("Error notifying %s of mention: %v", userID, err)
+		}
+	}
+}
+
+// notifyReply tells everyone who wrote in the thread about a new reply,
+// except its author and those it mentions, who already heard about it.
+func (c *commentUsecase) notifyReply(reply *domain.Comment) {
+	if c.notifier == nil {
+		return
+	}
+	comments, err := c.commentRepo.ListByThread(reply.ThreadID)
+	if err != nil {
+		log.Printf("Error loading thread %s: %v", reply.ThreadID, err)
+		return
+	}
+
+	skip := map[string]bool{reply.AuthorID: true}
+	for _, id := range reply.Mentions {
+		skip[id] = true
+	}
+	for _, comment := range comments {
+		if skip[comment.AuthorID] {
+			continue
+		}
+		skip[comment.AuthorID] = true
+		if _, err := c.memberUsecase.Role(reply.ArtboardID, comment.AuthorID); err != nil {
+			continue
+		}
+		if err := c.notifier.Notify(comment.AuthorID, domain.NotificationCommentReply, reply); err != nil {
+			log.Printf("Error notifying %s of reply: %v", comment.AuthorID, err)
+		}
+	}
+}
+
+// uniqueMentions drops duplicates and the author from a mention list.
+func uniqueMentions(mentions []string, authorID string) []string {
+	seen := make(map[string]bool, len(mentions))
+	var unique []string
+	for _, id := range mentions {
+		if id == "" || id == authorID || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
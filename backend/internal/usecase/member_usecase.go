@@ -0,0 +1,182 @@
+package usecase
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+
+	"goP2Pbackend/internal/domain"
+)
+
+type memberUsecase struct {
+	artboardRepo domain.ArtboardRepository
+	memberRepo   domain.MemberRepository
+	notifier     domain.Notifier
+}
+
+func NewMemberUsecase(ar domain.ArtboardRepository, mr domain.MemberRepository, n domain.Notifier) domain.MemberUsecase {
+	return &memberUsecase{
+		artboardRepo: ar,
+		memberRepo:   mr,
+		notifier:     n,
+	}
+}
+
+func (m *memberUsecase) Role(artboardID, userID string) (domain.Role, error) {
+	artboard, err := m.artboardRepo.GetByID(artboardID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load artboard: %w", err)
+	}
+	if artboard.OwnerID == userID {
+		return domain.RoleOwner, nil
+	}
+
+	member, err := m.memberRepo.Get(artboardID, userID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return "", domain.ErrForbidden
+	}
+	if err != nil {
+		return "", err
+	}
+	switch member.Role {
+	case domain.RoleRemoved:
+		return "", domain.ErrForbidden
+	case domain.RoleLinked:
+		if !validLink(artboard, member.ShareableID) {
+			return "", domain.ErrForbidden
+		}
+		return linkRole(artboard), nil
+	}
+	return member.Role, nil
+}
+
+// validLink reports whether shareableID is the artboard's current link.
+func validLink(artboard *domain.Artboard, shareableID string) bool {
+	return shareableID != "" && subtle.ConstantTimeCompare([]byte(shareableID), []byte(artboard.ShareableID)) == 1
+}
+
+// linkRole is the role of users who joined through the artboard's link.
+func linkRole(artboard *domain.Artboard) domain.Role {
+	if artboard.IsReadOnly {
+		return domain.RoleViewer
+	}
+	return domain.RoleEditor
+}
+
+func (m *memberUsecase) JoinByLink(artboardID, shareableID, userID string) (domain.Role, error) {
+	artboard, err := m.artboardRepo.GetByID(artboardID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load artboard: %w", err)
+	}
+	if !validLink(artboard, shareableID) {
+		return "", domain.ErrForbidden
+	}
+	if artboard.OwnerID == userID {
+		return domain.RoleOwner, nil
+	}
+
+	member, err := m.memberRepo.Get(artboardID, userID)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+	case err != nil:
+		return "", err
+	case member.Role == domain.RoleRemoved:
+		return "", domain.ErrForbidden
+	case member.Role != domain.RoleLinked:
+		// Members keep the role they were given.
+		return member.Role, nil
+	}
+	err = m.memberRepo.SetRole(&domain.Member{ArtboardID: artboardID, UserID: userID, Role: domain.RoleLinked, ShareableID: shareableID})
+	if err != nil {
+		return "", err
+	}
+	return linkRole(artboard), nil
+}
+
+func (m *memberUsecase) IsMember(artboardID, userID string) (bool, error) {
+	artboard, err := m.artboardRepo.GetByID(artboardID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load artboard: %w", err)
+	}
+	if artboard.OwnerID == userID {
+		return true, nil
+	}
+
+	member, err := m.memberRepo.Get(artboardID, userID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return member.Role != domain.RoleRemoved && member.Role != domain.RoleLinked, nil
+}
+
+// requireOwner fails with ErrForbidden unless actorID owns the artboard.
+func (m *memberUsecase) requireOwner(artboardID, actorID string) error {
+	role, err := m.Role(artboardID, actorID)
+	if err != nil {
+		return err
+	}
+	if role != domain.RoleOwner {
+		return domain.ErrForbidden
+	}
+	return nil
+}
+
+func (m *memberUsecase) SetRole(artboardID, actorID, userID string, role domain.Role) error {
+	if !role.Valid() || role == domain.RoleOwner {
+		return fmt.Errorf("role must be editor, commenter or viewer: %w", domain.ErrInvalid)
+	}
+	if err := m.requireOwner(artboardID, actorID); err != nil {
+		return err
+	}
+	if userID == actorID {
+		return fmt.Errorf("the owner's role cannot change: %w", domain.ErrInvalid)
+	}
+
+	previous, err := m.memberRepo.Get(artboardID, userID)
+	invited := errors.Is(err, domain.ErrNotFound)
+	if err != nil && !invited {
+		return err
+	}
+	if !invited {
+		invited = previous.Role == domain.RoleRemoved || previous.Role == domain.RoleLinked
+	}
+	if err := m.memberRepo.SetRole(&domain.Member{ArtboardID: artboardID, UserID: userID, Role: role}); err != nil {
+		return err
+	}
+
+	if invited && m.notifier != nil {
+		err := m.notifier.Notify(userID, domain.NotificationInvitation, map[string]interface{}{
+			"artboard_id": artboardID,
+			"role":        role,
+			"invited_by":  actorID,
+		})
+		if err != nil {
+			log.Printf("Error notifying %s of invitation: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// Remove takes away all of userID's access. The removal is recorded rather
+// than the membership deleted, so that the user cannot join again through
+// the link.
+func (m *memberUsecase) Remove(artboardID, actorID, userID string) error {
+	if err := m.requireOwner(artboardID, actorID); err != nil {
+		return err
+	}
+	if userID == actorID {
+		return fmt.Errorf("the owner cannot be removed: %w", domain.ErrInvalid)
+	}
+	return m.memberRepo.SetRole(&domain.Member{ArtboardID: artboardID, UserID: userID, Role: domain.RoleRemoved})
+}
+
+func (m *memberUsecase) List(artboardID, actorID string) ([]*domain.Member, error) {
+	if _, err := m.Role(artboardID, actorID); err != nil {
+		return nil, err
+	}
+	return m.memberRepo.ListByArtboard(artboardID)
+}
@@ -0,0 +1,177 @@
+package usecase
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// SendDigests goes through users this many at a time, and puts at most
+// this many notifications in one digest.
+const digestBatchSize = 1000
+
+var notificationSummaries = map[string]string{
+	domain.NotificationMention:      "You were mentioned in a comment",
+	domain.NotificationCommentReply: "Someone replied in a comment thread you are part of",
+	domain.NotificationInvitation:   "You were invited to an artboard",
+	domain.NotificationShare:        "The sharing settings of an artboard changed",
+}
+
+type notificationUsecase struct {
+	notificationRepo domain.NotificationRepository
+	userRepo         domain.UserRepository
+	pusher           domain.Notifier
+	presence         domain.Presence
+	mailer           domain.Mailer
+}
+
+// NewNotificationUsecase stores notifications and passes each one on to
+// pusher for live delivery, e.g. over the user's WebSocket connections.
+// Users presence reports online get no digests.
+func NewNotificationUsecase(nr domain.NotificationRepository, ur domain.UserRepository, pusher domain.Notifier, presence domain.Presence, mailer domain.Mailer) domain.NotificationUsecase {
+	return &notificationUsecase{
+		notificationRepo: nr,
+		userRepo:         ur,
+		pusher:           pusher,
+		presence:         presence,
+		mailer:           mailer,
+	}
+}
+
+func (n *notificationUsecase) Notify(userID, kind string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	notification := &domain.Notification{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Kind:      kind,
+		Data:      raw,
+		CreatedAt: time.Now(),
+	}
+	if err := n.notificationRepo.Create(notification); err != nil {
+		return fmt.Errorf("failed to save notification: %w", err)
+	}
+
+	if n.pusher != nil {
+		if err := n.pusher.Notify(userID, "notification", notification); err != nil {
+			log.Printf("Error pushing notification to %s: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+func (n *notificationUsecase) List(userID string, unreadOnly bool, before string, limit int) ([]*domain.Notification, error) {
+	return n.notificationRepo.ListByUser(userID, unreadOnly, before, limit)
+}
+
+func (n *notificationUsecase) CountUnread(userID string) (int, error) {
+	return n.notificationRepo.CountUnread(userID)
+}
+
+func (n *notificationUsecase) MarkRead(userID string, ids []string) error {
+	return n.notificationRepo.MarkRead(userID, ids, time.Now())
+}
+
+func (n *notificationUsecase) SendDigests(before time.Time) error {
+	after := ""
+	for {
+		users, err := n.notificationRepo.ListUndigestedUsers(after, before, digestBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list users to digest: %w", err)
+		}
+		for _, userID := range users {
+			if err := n.sendDigest(userID, before); err != nil {
+				return err
+			}
+		}
+		if len(users) < digestBatchSize {
+			return nil
+		}
+		after = users[len(users)-1]
+	}
+}
+
+// sendDigest emails userID their pending notifications, claiming them
+// first so that no other instance emails them too. A user who is online
+// or whose digest fails to send is left for the next run.
+func (n *notificationUsecase) sendDigest(userID string, before time.Time) error {
+	if n.presence != nil {
+		online, err := n.presence.IsOnline(userID)
+		if err != nil {
+			return fmt.Errorf("failed to check whether %s is online: %w", userID, err)
+		}
+		if online {
+			return nil
+		}
+	}
+	user, err := n.userRepo.GetByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to load user %s: %w", userID, err)
+	}
+
+	pending, err := n.notificationRepo.ClaimUndigested(userID, before, digestBatchSize, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to claim notifications: %w", err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if user.Email == "" {
+		// Nobody to send them to; they stay claimed so as not to try
+		// again on every run.
+		log.Printf("Skipping digest for %s: no email address", userID)
+		return nil
+	}
+	if err := n.mailer.Send(user.Email, digestSubject(len(pending)), digestBody(user, pending)); err != nil {
+		log.Printf("Error sending digest to %s: %v", userID, err)
+		ids := make([]string, len(pending))
+		for i, notification := range pending {
+			ids[i] = notification.ID
+		}
+		if err := n.notificationRepo.UnclaimEmailed(ids); err != nil {
+			return fmt.Errorf("failed to release notifications: %w", err)
+		}
+	}
+	return nil
+}
+
+func digestSubject(count int) string {
+	if count == 1 {
+		return "You have 1 unread notification"
+	}
+	return fmt.Sprintf("You have %d unread notifications", count)
+}
+
+func digestBody(user *domain.User, notifications []*domain.Notification) string {
+	var b strings.Builder
+	name := user.Name
+	if name == "" {
+		name = user.Email
+	}
+	fmt.Fprintf(&b, "Hi %s,\n\nHere is what happened while you were away:\n\n", name)
+	for _, notification := range notifications {
+		summary, ok := notificationSummaries[notification.Kind]
+		if !ok {
+			summary = notification.Kind
+		}
+		var fields struct {
+			ArtboardID string `json:"artboard_id"`
+		}
+		json.Unmarshal(notification.Data, &fields)
+
+		fmt.Fprintf(&b, "- %s %s", notification.CreatedAt.Format("Jan 2 15:04"), summary)
+		if fields.ArtboardID != "" {
+			fmt.Fprintf(&b, " (artboard %s)", fields.ArtboardID)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,158 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/board"
+)
+
+const (
+	// MaxReplaySpeed bounds how far a replay can be accelerated.
+	MaxReplaySpeed = 1000
+	// MaxReplayGap is the longest pause a replay keeps between two
+	// operations, before speed is applied, so idle stretches are skipped.
+	MaxReplayGap = 5 * time.Second
+)
+
+// replayPageSize is how many operations a replay loads at a time.
+const replayPageSize = 500
+
+type replayUsecase struct {
+	operationRepo   domain.OperationRepository
+	versionRepo     domain.VersionRepository
+	artboardStorage domain.ArtboardStorage
+	memberUsecase   domain.MemberUsecase
+}
+
+// NewReplayUsecase plays back the operation log. It never touches the live
+// room, so watching a replay does not affect the people drawing.
+func NewReplayUsecase(or domain.OperationRepository, vr domain.VersionRepository, as domain.ArtboardStorage, mu domain.MemberUsecase) domain.ReplayUsecase {
+	return &replayUsecase{
+		operationRepo:   or,
+		versionRepo:     vr,
+		artboardStorage: as,
+		memberUsecase:   mu,
+	}
+}
+
+func (u *replayUsecase) Replay(ctx context.Context, artboardID, userID string, fromSeq, toSeq int64, speed float64, send func(frame *domain.ReplayFrame) error) error {
+	if fromSeq < 0 || toSeq < 0 || (toSeq != 0 && toSeq < fromSeq) {
+		return fmt.Errorf("from and to must be sequence numbers with from <= to: %w", domain.ErrInvalid)
+	}
+	if math.IsNaN(speed) || speed <= 0 || speed > MaxReplaySpeed {
+		return fmt.Errorf("speed must be above 0 and at most %d: %w", MaxReplaySpeed, domain.ErrInvalid)
+	}
+	if _, err := u.memberUsecase.Role(artboardID, userID); err != nil {
+		return err
+	}
+
+	// Rebuild the board up to the starting point, the same way a room
+	// loads it.
+	doc, seq, err := u.start(artboardID, fromSeq)
+	if err != nil {
+		return err
+	}
+	if seq < fromSeq {
+		err := u.eachOperation(artboardID, seq, fromSeq, func(op *domain.Operation) error {
+			doc.Apply(op.Type, op.Data)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	objects, err := json.Marshal(doc.Objects)
+	if err != nil {
+		return err
+	}
+	if err := send(&domain.ReplayFrame{Event: domain.ReplaySnapshot, Seq: fromSeq, Objects: objects}); err != nil {
+		return err
+	}
+
+	seq = fromSeq
+	var last time.Time
+	err = u.eachOperation(artboardID, fromSeq, toSeq, func(op *domain.Operation) error {
+		if !last.IsZero() {
+			gap := op.CreatedAt.Sub(last)
+			if gap > MaxReplayGap {
+				gap = MaxReplayGap
+			}
+			if err := wait(ctx, time.Duration(float64(gap)/speed)); err != nil {
+				return err
+			}
+		}
+		last = op.CreatedAt
+
+		if err := send(&domain.ReplayFrame{Event: domain.ReplayOperation, Seq: op.Seq, Operation: op}); err != nil {
+			return err
+		}
+		seq = op.Seq
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return send(&domain.ReplayFrame{Event: domain.ReplayEnd, Seq: seq})
+}
+
+// start returns the board as of the latest version at or before fromSeq,
+// or an empty board if there is none, and the version's sequence number.
+func (u *replayUsecase) start(artboardID string, fromSeq int64) (*board.Document, int64, error) {
+	version, err := u.versionRepo.LatestAt(artboardID, fromSeq)
+	if errors.Is(err, domain.ErrNotFound) {
+		return board.New(), 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find a version to start from: %w", err)
+	}
+	data, err := u.artboardStorage.LoadVersion(artboardID, version.ID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load version %s: %w", version.ID, err)
+	}
+	doc, err := board.Parse(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return doc, version.Seq, nil
+}
+
+// eachOperation calls fn with the operations after fromSeq up to toSeq (0
+// for the latest), loading them a page at a time.
+func (u *replayUsecase) eachOperation(artboardID string, fromSeq, toSeq int64, fn func(op *domain.Operation) error) error {
+	for {
+		ops, err := u.operationRepo.ListPage(artboardID, fromSeq, toSeq, replayPageSize)
+		if err != nil {
+			return fmt.Errorf("failed to load operations: %w", err)
+		}
+		for _, op := range ops {
+			if err := fn(op); err != nil {
+				return err
+			}
+			fromSeq = op.Seq
+		}
+		if len(ops) < replayPageSize {
+			return nil
+		}
+	}
+}
+
+// wait sleeps for d unless ctx is done first.
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,260 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/board"
+
+	"github.com/google/uuid"
+)
+
+type versionUsecase struct {
+	versionRepo     domain.VersionRepository
+	operationRepo   domain.OperationRepository
+	artboardStorage domain.ArtboardStorage
+	memberUsecase   domain.MemberUsecase
+	submitter       domain.OperationSubmitter
+}
+
+func NewVersionUsecase(vr domain.VersionRepository, or domain.OperationRepository, as domain.ArtboardStorage, mu domain.MemberUsecase, s domain.OperationSubmitter) domain.VersionUsecase {
+	return &versionUsecase{
+		versionRepo:     vr,
+		operationRepo:   or,
+		artboardStorage: as,
+		memberUsecase:   mu,
+		submitter:       s,
+	}
+}
+
+func (v *versionUsecase) requireRole(artboardID, userID string, edit bool) error {
+	role, err := v.memberUsecase.Role(artboardID, userID)
+	if err != nil {
+		return err
+	}
+	if edit && !role.CanEdit() {
+		return domain.ErrForbidden
+	}
+	return nil
+}
+
+func (v *versionUsecase) save(version *domain.Version, data []byte) error {
+	return saveVersion(v.versionRepo, v.artboardStorage, version, data)
+}
+
+// saveVersion stores a document and records it as a version.
+func saveVersion(vr domain.VersionRepository, as domain.ArtboardStorage, version *domain.Version, data []byte) error {
+	if err := as.SaveVersion(version.ArtboardID, version.ID, data); err != nil {
+		return fmt.Errorf("failed to store version: %w", err)
+	}
+	if err := vr.Create(version); err != nil {
+		return fmt.Errorf("failed to save version: %w", err)
+	}
+	return nil
+}
+
+func (v *versionUsecase) Checkpoint(artboardID string, seq int64, data []byte) (*domain.Version, error) {
+	version := &domain.Version{
+		ID:         uuid.New().String(),
+		ArtboardID: artboardID,
+		Seq:        seq,
+		CreatedAt:  time.Now(),
+	}
+	if err := v.save(version, data); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+func (v *versionUsecase) Latest(artboardID string) (*domain.Version, []byte, error) {
+	version, err := v.versionRepo.Latest(artboardID)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := v.artboardStorage.LoadVersion(artboardID, version.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load version %s: %w", version.ID, err)
+	}
+	return version, data, nil
+}
+
+func (v *versionUsecase) head(artboardID string) (*board.Document, int64, error) {
+	return loadHead(v.versionRepo, v.operationRepo, v.artboardStorage, artboardID)
+}
+
+// loadHead rebuilds a board as it is now from its latest version and the
+// operations logged since.
+func loadHead(vr domain.VersionRepository, or domain.OperationRepository, as domain.ArtboardStorage, artboardID string) (*board.Document, int64, error) {
+	doc := board.New()
+	var seq int64
+
+	latest, err := vr.Latest(artboardID)
+	switch {
+	case err == nil:
+		data, err := as.LoadVersion(artboardID, latest.ID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to load version %s: %w", latest.ID, err)
+		}
+		if doc, err = board.Parse(data); err != nil {
+			return nil, 0, err
+		}
+		seq = latest.Seq
+	case !errors.Is(err, domain.ErrNotFound):
+		return nil, 0, err
+	}
+
+	ops, err := or.ListByArtboard(artboardID, seq, 0)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load operations: %w", err)
+	}
+	for _, op := range ops {
+		// An operation that no longer applies was rejected live too.
+		doc.Apply(op.Type, op.Data)
+		seq = op.Seq
+	}
+	return doc, seq, nil
+}
+
+func (v *versionUsecase) Create(artboardID, userID, name string) (*domain.Version, error) {
+	if name == "" {
+		return nil, fmt.Errorf("a version needs a name: %w", domain.ErrInvalid)
+	}
+	if err := v.requireRole(artboardID, userID, true); err != nil {
+		return nil, err
+	}
+
+	doc, seq, err := v.head(artboardID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := doc.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	version := &domain.Version{
+		ID:         uuid.New().String(),
+		ArtboardID: artboardID,
+		Seq:        seq,
+		Name:       name,
+		CreatedBy:  userID,
+		CreatedAt:  time.Now(),
+	}
+	if err := v.save(version, data); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+func (v *versionUsecase) List(artboardID, userID string) ([]*domain.Version, error) {
+	if err := v.requireRole(artboardID, userID, false); err != nil {
+		return nil, err
+	}
+	return v.versionRepo.ListByArtboard(artboardID)
+}
+
+func (v *versionUsecase) Load(artboardID, versionID, userID string) (*domain.Version, []byte, error) {
+	if err := v.requireRole(artboardID, userID, false); err != nil {
+		return nil, nil, err
+	}
+	version, err := v.versionRepo.GetByID(versionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version.ArtboardID != artboardID {
+		return nil, nil, domain.ErrNotFound
+	}
+	data, err := v.artboardStorage.LoadVersion(artboardID, versionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load version %s: %w", versionID, err)
+	}
+	return version, data, nil
+}
+
+func (v *versionUsecase) Restore(artboardID, versionID, userID string) (*domain.Version, error) {
+	if err := v.requireRole(artboardID, userID, true); err != nil {
+		return nil, err
+	}
+	source, data, err := v.Load(artboardID, versionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	data, seq, err := v.submitter.Patch(artboardID, userID, nil, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply restore: %w", err)
+	}
+
+	name := source.Name
+	if name == "" {
+		name = source.CreatedAt.Format(time.RFC3339)
+	}
+	version := &domain.Version{
+		ID:           uuid.New().String(),
+		ArtboardID:   artboardID,
+		Seq:          seq,
+		Name:         "Restored from " + name,
+		CreatedBy:    userID,
+		RestoredFrom: source.ID,
+		CreatedAt:    time.Now(),
+	}
+	if err := v.save(version, data); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// snapshot returns the document of a version, or of the live board for
+// domain.VersionHead.
+func (v *versionUsecase) snapshot(artboardID, versionID, userID string) (*board.Document, error) {
+	if versionID == domain.VersionHead {
+		doc, _, err := v.head(artboardID)
+		return doc, err
+	}
+	_, data, err := v.Load(artboardID, versionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return board.Parse(data)
+}
+
+func (v *versionUsecase) Diff(artboardID, fromID, toID, userID string) (*domain.VersionDiff, error) {
+	if fromID == "" {
+		return nil, fmt.Errorf("from is required: %w", domain.ErrInvalid)
+	}
+	if toID == "" {
+		toID = domain.VersionHead
+	}
+	if err := v.requireRole(artboardID, userID, false); err != nil {
+		return nil, err
+	}
+	from, err := v.snapshot(artboardID, fromID, userID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := v.snapshot(artboardID, toID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := board.Compare(from, to)
+	diff := &domain.VersionDiff{
+		From:     fromID,
+		To:       toID,
+		Added:    make([]json.RawMessage, 0, len(changes.Added)),
+		Removed:  make([]json.RawMessage, 0, len(changes.Removed)),
+		Modified: make([]*domain.ObjectChange, 0, len(changes.Modified)),
+	}
+	for _, id := range changes.Added {
+		diff.Added = append(diff.Added, to.Objects[id])
+	}
+	for _, id := range changes.Removed {
+		diff.Removed = append(diff.Removed, from.Objects[id])
+	}
+	for _, id := range changes.Modified {
+		diff.Modified = append(diff.Modified, &domain.ObjectChange{ID: id, Before: from.Objects[id], After: to.Objects[id]})
+	}
+	return diff, nil
+}
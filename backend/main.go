@@ -1,79 +1,269 @@
-package main
-
-import (
-	"fmt"
-	"log"
-	"net/http"
-
-	"goP2Pbackend/config"
-	"goP2Pbackend/internal/delivery/http/handler"
-	"goP2Pbackend/internal/repository/postgres"
-	"goP2Pbackend/internal/repository/s3"
-	"goP2Pbackend/internal/usecase"
-	"goP2Pbackend/pkg/auth"
-	websocket "goP2Pbackend/pkg/ws"
-
-	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
-)
-
-func main() {
-	// Load .env file if it exists
-	err := godotenv.Load()
-	if err != nil {
-		fmt.Println("Error loading the ENV file")
-		panic(err)
-	}
-
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
-	}
-
-	db, err := postgres.NewDB(cfg.GetDatabaseURL())
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-	}
-
-	s3Client, err := s3.NewClient(cfg.AWS.Region, cfg.AWS.AccessKeyID, cfg.AWS.SecretAccessKey)
-	if err != nil {
-		log.Fatalf("Failed to create S3 client: %v", err)
-	}
-
-	userRepo := postgres.NewUserRepository(db)
-	artboardRepo := postgres.NewArtboardRepository(db)
-	artboardStorage := s3.NewArtboardStorage(s3Client, cfg.AWS.BucketName)
-
-	userUsecase := usecase.NewUserUsecase(userRepo)
-	artboardUsecase := usecase.NewArtboardUsecase(artboardRepo, artboardStorage)
-
-	oauthConfig := auth.NewOAuthConfig(cfg.OAuth.GoogleClientID, cfg.OAuth.GoogleClientSecret, cfg.OAuth.OAuthRedirectURL)
-
-	userHandler := handler.NewUserHandler(userUsecase, oauthConfig)
-	artboardHandler := handler.NewArtboardHandler(artboardUsecase)
-
-	hub := websocket.NewHub()
-	go hub.Run()
-
-	r := mux.NewRouter()
-
-	// User routes
-	r.HandleFunc("/auth/google", userHandler.GoogleLogin)
-	r.HandleFunc("/auth/google/callback", userHandler.GoogleCallback)
-
-	// Artboard routes
-	r.HandleFunc("/artboards", artboardHandler.Create).Methods("POST")
-	r.HandleFunc("/artboards", artboardHandler.List).Methods("GET")
-	r.HandleFunc("/artboards/{id}", artboardHandler.Get).Methods("GET")
-	r.HandleFunc("/artboards/{id}", artboardHandler.Update).Methods("PUT")
-	r.HandleFunc("/artboards/{id}", artboardHandler.Delete).Methods("DELETE")
-	r.HandleFunc("/artboards/{id}/share", artboardHandler.GenerateShareableLink).Methods("POST")
-
-	// WebSocket route
-	r.HandleFunc("/ws/{artboardID}", func(w http.ResponseWriter, r *http.Request) {
-		websocket.ServeWs(hub, w, r)
-	})
-
-	log.Printf("Server starting on port %s", cfg.Server.Port)
-	log.Fatal(http.ListenAndServe(":"+cfg.Server.Port, r))
-}
+package main
+
+import (
+	"crypto/rand"
+	"log"
+	"net/http"
+	"time"
+
+	"goP2Pbackend/config"
+	"goP2Pbackend/internal/delivery/http/handler"
+	"goP2Pbackend/internal/delivery/http/middleware"
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/internal/repository/postgres"
+	"goP2Pbackend/internal/repository/storage"
+	"goP2Pbackend/internal/usecase"
+	"goP2Pbackend/pkg/auth"
+	"goP2Pbackend/pkg/mail"
+	websocket "goP2Pbackend/pkg/ws"
+
+	"github.com/gorilla/mux"
+	"github.com/joho/godotenv"
+)
+
+// How often each instance reports the users connected to it.
+const presenceInterval = 15 * time.Second
+
+func main() {
+	// Load .env file if it exists; the environment alone is enough otherwise.
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	db, err := postgres.NewDB(cfg.GetDatabaseURL())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	blobStore, err := storage.OpenBlobStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create blob store: %v", err)
+	}
+
+	keyring, err := cfg.Storage.Keyring()
+	if err != nil {
+		log.Fatalf("Failed to load master keys: %v", err)
+	}
+	blobRepo := postgres.NewBlobRepository(db)
+	dataKeyRepo := postgres.NewDataKeyRepository(db)
+	artboardStorage := storage.NewArtboardStorage(blobStore, blobRepo, cfg.Storage.Compression, dataKeyRepo, keyring)
+	userRepo := postgres.NewUserRepository(db)
+	artboardRepo := postgres.NewArtboardRepository(db)
+	operationRepo := postgres.NewOperationRepository(db)
+	chatRepo := postgres.NewChatRepository(db)
+	memberRepo := postgres.NewMemberRepository(db)
+	commentRepo := postgres.NewCommentRepository(db)
+	notificationRepo := postgres.NewNotificationRepository(db)
+	versionRepo := postgres.NewVersionRepository(db)
+	branchRepo := postgres.NewBranchRepository(db)
+	presenceRepo := postgres.NewPresenceRepository(db, 3*presenceInterval)
+
+	broker := websocket.NewMemoryBroker()
+	if cfg.WS.Broker == "postgres" {
+		broker, err = postgres.NewBroker(db, cfg.GetDatabaseURL())
+		if err != nil {
+			log.Fatalf("Failed to start WebSocket broker: %v", err)
+		}
+	}
+
+	rateLimits := make(map[string]websocket.RateLimit, len(cfg.WS.RateLimits))
+	for class, limit := range cfg.WS.RateLimits {
+		rateLimits[class] = websocket.RateLimit{Rate: limit.Rate, Burst: limit.Burst}
+	}
+
+	hub := websocket.NewHub(websocket.Config{
+		WriteWait:          cfg.WS.WriteWait,
+		PongWait:           cfg.WS.PongWait,
+		PingPeriod:         cfg.WS.PingPeriod,
+		MaxMessageSize:     cfg.WS.MaxMessageSize,
+		ReadBufferSize:     cfg.WS.ReadBufferSize,
+		WriteBufferSize:    cfg.WS.WriteBufferSize,
+		SendBufferSize:     cfg.WS.SendBufferSize,
+		RoomBufferSize:     cfg.WS.RoomBufferSize,
+		MaxDroppedMessages: cfg.WS.MaxDroppedMessages,
+		EnableCompression:  cfg.WS.EnableCompression,
+		CompressionLevel:   cfg.WS.CompressionLevel,
+		BatchMaxMessages:   cfg.WS.BatchMaxMessages,
+		BatchMaxBytes:      cfg.WS.BatchMaxBytes,
+		RateLimits:         rateLimits,
+		RoomRateLimit:      websocket.RateLimit{Rate: cfg.WS.RoomRateLimit.Rate, Burst: cfg.WS.RoomRateLimit.Burst},
+		MaxRateViolations:  cfg.WS.MaxRateViolations,
+		ICEServers:         cfg.WS.ICEServers,
+		MaxUndoDepth:       cfg.WS.MaxUndoDepth,
+		LockTimeout:        cfg.WS.LockTimeout,
+		CheckpointEvery:    cfg.WS.CheckpointEvery,
+		CheckpointInterval: cfg.WS.CheckpointInterval,
+	}, broker, operationRepo)
+
+	var mailer domain.Mailer = mail.NewLogMailer()
+	if cfg.Mail.Driver == "smtp" {
+		mailer = mail.NewSMTPMailer(cfg.Mail.SMTPHost, cfg.Mail.SMTPPort, cfg.Mail.SMTPUsername, string(cfg.Mail.SMTPPassword), cfg.Mail.From)
+	}
+
+	userUsecase := usecase.NewUserUsecase(userRepo)
+	notificationUsecase := usecase.NewNotificationUsecase(notificationRepo, userRepo, hub, presenceRepo, mailer)
+	memberUsecase := usecase.NewMemberUsecase(artboardRepo, memberRepo, notificationUsecase)
+	artboardUsecase := usecase.NewArtboardUsecase(artboardRepo, artboardStorage, versionRepo, operationRepo, memberRepo, memberUsecase, notificationUsecase, hub)
+	chatUsecase := usecase.NewChatUsecase(chatRepo, memberUsecase)
+	commentUsecase := usecase.NewCommentUsecase(commentRepo, memberUsecase, notificationUsecase)
+	versionUsecase := usecase.NewVersionUsecase(versionRepo, operationRepo, artboardStorage, memberUsecase, hub)
+	branchUsecase := usecase.NewBranchUsecase(branchRepo, versionRepo, operationRepo, artboardStorage, artboardUsecase, memberUsecase, hub)
+	replayUsecase := usecase.NewReplayUsecase(operationRepo, versionRepo, artboardStorage, memberUsecase)
+
+	oauthConfig := auth.NewOAuthConfig(cfg.OAuth.GoogleClientID, cfg.OAuth.GoogleClientSecret, cfg.OAuth.OAuthRedirectURL)
+
+	ticketKey := []byte(cfg.Auth.TicketSecret)
+	if len(ticketKey) == 0 {
+		log.Printf("AUTH_TICKET_SECRET is not set; connection tickets only work on this instance")
+		ticketKey = make([]byte, 32)
+		if _, err := rand.Read(ticketKey); err != nil {
+			log.Fatalf("Failed to generate a ticket key: %v", err)
+		}
+	}
+	tickets := auth.NewTickets(ticketKey, cfg.Auth.TicketTTL)
+
+	userHandler := handler.NewUserHandler(userUsecase, oauthConfig, tickets)
+	artboardHandler := handler.NewArtboardHandler(artboardUsecase, cfg.Storage.MaxDataSize)
+
+	hub.SetEditPolicy(func(artboardID, userID string) (bool, error) {
+		role, err := memberUsecase.Role(artboardID, userID)
+		return role.CanEdit(), err
+	})
+	hub.SetCheckpointer(func(artboardID string, seq int64, data []byte) error {
+		_, err := versionUsecase.Checkpoint(artboardID, seq, data)
+		return err
+	})
+	hub.SetCheckpointLoader(func(artboardID string) ([]byte, int64, error) {
+		version, data, err := versionUsecase.Latest(artboardID)
+		if err != nil {
+			return nil, 0, err
+		}
+		return data, version.Seq, nil
+	})
+
+	chatHandler := handler.NewChatHandler(chatUsecase, hub)
+	hub.Handle(handler.TypeChat, chatHandler.Receive)
+	commentHandler := handler.NewCommentHandler(commentUsecase, hub)
+	memberHandler := handler.NewMemberHandler(memberUsecase)
+	notificationHandler := handler.NewNotificationHandler(notificationUsecase)
+	versionHandler := handler.NewVersionHandler(versionUsecase)
+	branchHandler := handler.NewBranchHandler(branchUsecase)
+	replayHandler := handler.NewReplayHandler(replayUsecase)
+
+	go func() {
+		ticker := time.NewTicker(presenceInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := presenceRepo.Touch(hub.InstanceID(), hub.OnlineUsers(), time.Now()); err != nil {
+				log.Printf("Failed to report online users: %v", err)
+			}
+		}
+	}()
+
+	if cfg.Mail.DigestInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.Mail.DigestInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				// Only what users had a whole interval to see live.
+				if err := notificationUsecase.SendDigests(time.Now().Add(-cfg.Mail.DigestInterval)); err != nil {
+					log.Printf("Failed to send notification digests: %v", err)
+				}
+			}
+		}()
+	}
+
+	if cfg.Storage.GCInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.Storage.GCInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				deleted, err := storage.CollectGarbage(blobStore, blobRepo, cfg.Storage.GCGrace)
+				if err != nil {
+					log.Printf("Failed to collect unreferenced blobs: %v", err)
+				}
+				if deleted > 0 {
+					log.Printf("Deleted %d unreferenced blobs", deleted)
+				}
+			}
+		}()
+	}
+
+	authMiddleware := middleware.AuthMiddleware(userUsecase)
+	ticketMiddleware := middleware.TicketMiddleware(userUsecase, tickets)
+
+	r := mux.NewRouter()
+
+	// User routes
+	r.HandleFunc("/auth/google", userHandler.GoogleLogin)
+	r.HandleFunc("/auth/google/callback", userHandler.GoogleCallback)
+	r.Handle("/auth/ticket", authMiddleware(http.HandlerFunc(userHandler.Ticket))).Methods("POST")
+
+	// Artboard routes
+	r.HandleFunc("/artboards", artboardHandler.Create).Methods("POST")
+	r.HandleFunc("/artboards", artboardHandler.List).Methods("GET")
+	r.HandleFunc("/artboards/{id}", artboardHandler.Get).Methods("GET")
+	r.HandleFunc("/artboards/{id}", artboardHandler.Update).Methods("PUT")
+	r.HandleFunc("/artboards/{id}", artboardHandler.Delete).Methods("DELETE")
+	r.HandleFunc("/artboards/{id}/share", artboardHandler.GenerateShareableLink).Methods("POST")
+	r.Handle("/artboards/{id}/data", authMiddleware(http.HandlerFunc(artboardHandler.GetData))).Methods("GET")
+	r.Handle("/artboards/{id}/data", authMiddleware(http.HandlerFunc(artboardHandler.PutData))).Methods("PUT")
+
+	// Chat routes
+	r.Handle("/artboards/{id}/chat", authMiddleware(http.HandlerFunc(chatHandler.List))).Methods("GET")
+	r.Handle("/artboards/{id}/chat/read", authMiddleware(http.HandlerFunc(chatHandler.MarkRead))).Methods("POST")
+	r.Handle("/artboards/{id}/chat/{messageID}", authMiddleware(http.HandlerFunc(chatHandler.Edit))).Methods("PUT")
+	r.Handle("/artboards/{id}/chat/{messageID}", authMiddleware(http.HandlerFunc(chatHandler.Delete))).Methods("DELETE")
+
+	// Comment routes
+	r.Handle("/artboards/{id}/comments", authMiddleware(http.HandlerFunc(commentHandler.List))).Methods("GET")
+	r.Handle("/artboards/{id}/comments", authMiddleware(http.HandlerFunc(commentHandler.Create))).Methods("POST")
+	r.Handle("/artboards/{id}/comments/{commentID}", authMiddleware(http.HandlerFunc(commentHandler.Update))).Methods("PUT")
+	r.Handle("/artboards/{id}/comments/{commentID}", authMiddleware(http.HandlerFunc(commentHandler.Delete))).Methods("DELETE")
+	r.Handle("/artboards/{id}/comments/{commentID}/replies", authMiddleware(http.HandlerFunc(commentHandler.Reply))).Methods("POST")
+	r.Handle("/artboards/{id}/comments/{commentID}/resolve", authMiddleware(http.HandlerFunc(commentHandler.Resolve))).Methods("POST")
+	r.Handle("/artboards/{id}/comments/{commentID}/reopen", authMiddleware(http.HandlerFunc(commentHandler.Reopen))).Methods("POST")
+
+	// Version routes
+	r.Handle("/artboards/{id}/versions", authMiddleware(http.HandlerFunc(versionHandler.List))).Methods("GET")
+	r.Handle("/artboards/{id}/versions", authMiddleware(http.HandlerFunc(versionHandler.Create))).Methods("POST")
+	r.Handle("/artboards/{id}/versions/{versionID}", authMiddleware(http.HandlerFunc(versionHandler.Get))).Methods("GET")
+	r.Handle("/artboards/{id}/versions/{versionID}/restore", authMiddleware(http.HandlerFunc(versionHandler.Restore))).Methods("POST")
+	r.Handle("/artboards/{id}/diff", authMiddleware(http.HandlerFunc(versionHandler.Diff))).Methods("GET")
+	r.Handle("/artboards/{id}/fork", authMiddleware(http.HandlerFunc(branchHandler.Fork))).Methods("POST")
+	r.Handle("/artboards/{id}/branches", authMiddleware(http.HandlerFunc(branchHandler.List))).Methods("GET")
+	r.Handle("/artboards/{id}/merge", authMiddleware(http.HandlerFunc(branchHandler.Preview))).Methods("GET")
+	r.Handle("/artboards/{id}/merge", authMiddleware(http.HandlerFunc(branchHandler.Merge))).Methods("POST")
+	r.Handle("/artboards/{id}/replay", ticketMiddleware(http.HandlerFunc(replayHandler.Replay))).Methods("GET")
+
+	// Notification routes
+	r.Handle("/me/notifications", authMiddleware(http.HandlerFunc(notificationHandler.List))).Methods("GET")
+	r.Handle("/me/notifications/read", authMiddleware(http.HandlerFunc(notificationHandler.MarkRead))).Methods("POST")
+
+	// Member routes
+	r.Handle("/artboards/{id}/members", authMiddleware(http.HandlerFunc(memberHandler.List))).Methods("GET")
+	r.Handle("/artboards/{id}/join", authMiddleware(http.HandlerFunc(memberHandler.Join))).Methods("POST")
+	r.Handle("/artboards/{id}/members/{userID}", authMiddleware(http.HandlerFunc(memberHandler.SetRole))).Methods("PUT")
+	r.Handle("/artboards/{id}/members/{userID}", authMiddleware(http.HandlerFunc(memberHandler.Remove))).Methods("DELETE")
+
+	// WebSocket route
+	r.Handle("/ws/{artboardID}", ticketMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := middleware.UserFromContext(r.Context())
+		if !ok {
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		websocket.ServeWs(hub, user.ID, w, r)
+	})))
+	r.HandleFunc("/metrics/ws", func(w http.ResponseWriter, r *http.Request) {
+		websocket.ServeMetrics(hub, w, r)
+	}).Methods("GET")
+
+	log.Printf("Server starting on port %s", cfg.Server.Port)
+	log.Fatal(http.ListenAndServe(":"+cfg.Server.Port, r))
+}
@@ -0,0 +1,16 @@
+-- Shared state for WebSocket rooms spread across server instances.
+
+CREATE TABLE IF NOT EXISTS artboard_sequences (
+    artboard_id VARCHAR(255) PRIMARY KEY,
+    seq         BIGINT NOT NULL
+);
+
+-- Payloads too large for a NOTIFY are parked here and referenced by ID.
+CREATE TABLE IF NOT EXISTS ws_broker_messages (
+    id          BIGSERIAL PRIMARY KEY,
+    artboard_id VARCHAR(255) NOT NULL,
+    payload     TEXT NOT NULL,
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ws_broker_messages_created_at ON ws_broker_messages (created_at);
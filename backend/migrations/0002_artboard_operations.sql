@@ -0,0 +1,16 @@
+-- Operation log: every sequenced mutation applied to an artboard.
+
+CREATE TABLE IF NOT EXISTS artboard_operations (
+    artboard_id VARCHAR(255) NOT NULL,
+    seq         BIGINT NOT NULL,
+    op_id       VARCHAR(255) NOT NULL,
+    user_id     VARCHAR(255) NOT NULL,
+    type        VARCHAR(32) NOT NULL,
+    object_id   VARCHAR(255) NOT NULL,
+    data        JSONB NOT NULL,
+    prev        JSONB,
+    undo_of     BIGINT,
+    redo_of     BIGINT,
+    created_at  TIMESTAMP NOT NULL,
+    PRIMARY KEY (artboard_id, seq)
+);
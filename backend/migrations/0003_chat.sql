@@ -0,0 +1,20 @@
+-- In-board chat and per-user read markers.
+
+CREATE TABLE IF NOT EXISTS chat_messages (
+    id          VARCHAR(255) PRIMARY KEY,
+    artboard_id VARCHAR(255) NOT NULL,
+    author_id   VARCHAR(255) NOT NULL,
+    body        TEXT NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    edited_at   TIMESTAMP,
+    deleted_at  TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS chat_messages_artboard_idx ON chat_messages (artboard_id, created_at DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS chat_reads (
+    artboard_id  VARCHAR(255) NOT NULL,
+    user_id      VARCHAR(255) NOT NULL,
+    last_read_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (artboard_id, user_id)
+);
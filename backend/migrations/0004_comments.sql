@@ -0,0 +1,26 @@
+-- Artboard roles and comment threads.
+
+CREATE TABLE IF NOT EXISTS artboard_members (
+    artboard_id VARCHAR(255) NOT NULL,
+    user_id     VARCHAR(255) NOT NULL,
+    role        VARCHAR(32) NOT NULL,
+    PRIMARY KEY (artboard_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id          VARCHAR(255) PRIMARY KEY,
+    artboard_id VARCHAR(255) NOT NULL,
+    thread_id   VARCHAR(255) NOT NULL,
+    author_id   VARCHAR(255) NOT NULL,
+    body        TEXT NOT NULL,
+    anchor      JSONB,
+    mentions    JSONB,
+    resolved    BOOLEAN NOT NULL DEFAULT FALSE,
+    resolved_by VARCHAR(255),
+    resolved_at TIMESTAMP,
+    created_at  TIMESTAMP NOT NULL,
+    edited_at   TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS comments_artboard_idx ON comments (artboard_id, created_at);
+CREATE INDEX IF NOT EXISTS comments_thread_idx ON comments (thread_id);
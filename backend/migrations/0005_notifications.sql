@@ -0,0 +1,14 @@
+-- Notification center.
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id         VARCHAR(255) PRIMARY KEY,
+    user_id    VARCHAR(255) NOT NULL,
+    kind       VARCHAR(64) NOT NULL,
+    data       JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    read_at    TIMESTAMP,
+    emailed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_idx ON notifications (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS notifications_undigested_idx ON notifications (user_id, created_at) WHERE read_at IS NULL AND emailed_at IS NULL;
@@ -0,0 +1,13 @@
+-- Version history. Documents live in artboard storage under each version's ID.
+
+CREATE TABLE IF NOT EXISTS artboard_versions (
+    id            VARCHAR(255) PRIMARY KEY,
+    artboard_id   VARCHAR(255) NOT NULL,
+    seq           BIGINT NOT NULL,
+    name          VARCHAR(255),
+    created_by    VARCHAR(255),
+    restored_from VARCHAR(255),
+    created_at    TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS artboard_versions_artboard_idx ON artboard_versions (artboard_id, seq DESC, created_at DESC);
@@ -0,0 +1,12 @@
+-- Artboards forked from another artboard, to be merged back.
+
+CREATE TABLE IF NOT EXISTS artboard_branches (
+    artboard_id     VARCHAR(255) PRIMARY KEY,
+    parent_id       VARCHAR(255) NOT NULL,
+    base_version_id VARCHAR(255) NOT NULL,
+    created_by      VARCHAR(255) NOT NULL,
+    created_at      TIMESTAMP NOT NULL,
+    merged_at       TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS artboard_branches_parent_idx ON artboard_branches (parent_id, created_at);
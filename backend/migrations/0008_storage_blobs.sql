@@ -0,0 +1,21 @@
+-- Content-addressed artboard data. Storage keys (an artboard's current data
+-- or one of its versions) point at blobs named by the hash of their content;
+-- blobs nothing points at are garbage collected.
+
+CREATE TABLE IF NOT EXISTS storage_blobs (
+    hash            VARCHAR(64) PRIMARY KEY,
+    encoding        VARCHAR(16) NOT NULL,
+    size            BIGINT NOT NULL,
+    stored_size     BIGINT NOT NULL,
+    ref_count       INTEGER NOT NULL DEFAULT 0,
+    created_at      TIMESTAMP NOT NULL,
+    unreferenced_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS storage_blobs_unreferenced_idx ON storage_blobs (unreferenced_at) WHERE ref_count = 0;
+
+CREATE TABLE IF NOT EXISTS storage_refs (
+    key        VARCHAR(512) PRIMARY KEY,
+    hash       VARCHAR(64) NOT NULL REFERENCES storage_blobs (hash),
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,14 @@
+-- Envelope encryption: per-artboard data keys wrapped by a master key, and
+-- the data key each stored blob is encrypted with.
+
+CREATE TABLE IF NOT EXISTS artboard_keys (
+    artboard_id   VARCHAR(255) PRIMARY KEY,
+    wrapped_key   BYTEA NOT NULL,
+    master_key_id VARCHAR(64) NOT NULL,
+    created_at    TIMESTAMP NOT NULL,
+    rotated_at    TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS artboard_keys_master_key_idx ON artboard_keys (master_key_id);
+
+ALTER TABLE storage_blobs ADD COLUMN IF NOT EXISTS key_id VARCHAR(255);
@@ -0,0 +1,3 @@
+-- SHA-256 of each blob as stored, verified on load and by the scrub command.
+
+ALTER TABLE storage_blobs ADD COLUMN IF NOT EXISTS checksum VARCHAR(64);
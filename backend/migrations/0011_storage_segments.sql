@@ -0,0 +1,3 @@
+-- Encrypted blobs written in segments, so that they can be read as a stream.
+
+ALTER TABLE storage_blobs ADD COLUMN IF NOT EXISTS segmented BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- The share link through which a user was let in, so that new links revoke old ones.
+
+ALTER TABLE artboard_members ADD COLUMN IF NOT EXISTS shareable_id VARCHAR(255) NOT NULL DEFAULT '';
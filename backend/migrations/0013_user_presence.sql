@@ -0,0 +1,11 @@
+-- Users connected to each instance, refreshed periodically, so that any
+-- instance can tell whether a user is online anywhere.
+
+CREATE TABLE IF NOT EXISTS user_presence (
+    user_id     VARCHAR(255) NOT NULL,
+    instance_id VARCHAR(255) NOT NULL,
+    seen_at     TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, instance_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_presence_instance_idx ON user_presence (instance_id);
@@ -0,0 +1,77 @@
+package board
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// Diff lists the IDs of the objects that differ between two documents.
+type Diff struct {
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+// Mutation is a single operation, as stored in the operation log.
+type Mutation struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Compare returns what changed from one document to the other. IDs are
+// sorted so the result is stable.
+func Compare(from, to *Document) *Diff {
+	diff := &Diff{Added: []string{}, Removed: []string{}, Modified: []string{}}
+	for id, object := range to.Objects {
+		prev, ok := from.Objects[id]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, id)
+		case !sameObject(prev, object):
+			diff.Modified = append(diff.Modified, id)
+		}
+	}
+	for id := range from.Objects {
+		if _, ok := to.Objects[id]; !ok {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Modified)
+	return diff
+}
+
+// Patch returns the mutations that turn from into to: an add for every new
+// or modified object and a delete for every removed one.
+func Patch(from, to *Document) ([]Mutation, error) {
+	diff := Compare(from, to)
+	mutations := make([]Mutation, 0, len(diff.Added)+len(diff.Modified)+len(diff.Removed))
+	for _, ids := range [][]string{diff.Added, diff.Modified} {
+		for _, id := range ids {
+			mutations = append(mutations, Mutation{Type: OpAdd, Data: to.Objects[id]})
+		}
+	}
+	for _, id := range diff.Removed {
+		data, err := json.Marshal(map[string]string{"id": id})
+		if err != nil {
+			return nil, err
+		}
+		mutations = append(mutations, Mutation{Type: OpDelete, Data: data})
+	}
+	return mutations, nil
+}
+
+// sameObject compares two objects as JSON values, ignoring formatting and
+// field order.
+func sameObject(a, b json.RawMessage) bool {
+	if string(a) == string(b) {
+		return true
+	}
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
@@ -0,0 +1,168 @@
+package board
+
+// This file implements the object-level document model of an artboard.
+// A document is every object on the board keyed by its ID; mutations add,
+// update (as a shallow JSON merge patch) or delete one object at a time.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Mutation types understood by Apply.
+const (
+	OpStroke = "stroke"
+	OpAdd    = "add"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+var (
+	ErrMissingID      = errors.New("object has no id")
+	ErrObjectNotFound = errors.New("object not found")
+	ErrUnknownOp      = errors.New("unknown operation")
+)
+
+type Document struct {
+	Objects map[string]json.RawMessage `json:"objects"`
+}
+
+func New() *Document {
+	return &Document{Objects: make(map[string]json.RawMessage)}
+}
+
+// Parse reads a stored document. Empty data is an empty document.
+func Parse(data []byte) (*Document, error) {
+	doc := New()
+	if len(data) == 0 {
+		return doc, nil
+	}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("failed to parse document: %w", err)
+	}
+	if doc.Objects == nil {
+		doc.Objects = make(map[string]json.RawMessage)
+	}
+	return doc, nil
+}
+
+func (d *Document) Marshal() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+// ObjectID returns the "id" field of an operation's data.
+func ObjectID(data json.RawMessage) (string, error) {
+	var fields struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", fmt.Errorf("invalid operation data: %w", err)
+	}
+	if fields.ID == "" {
+		return "", ErrMissingID
+	}
+	return fields.ID, nil
+}
+
+// Apply performs a mutation and returns the object as it was before, or nil
+// if it did not exist.
+func (d *Document) Apply(opType string, data json.RawMessage) (json.RawMessage, error) {
+	id, err := ObjectID(data)
+	if err != nil {
+		return nil, err
+	}
+	prev, exists := d.Objects[id]
+
+	switch opType {
+	case OpAdd, OpStroke:
+		d.Objects[id] = data
+	case OpUpdate:
+		if !exists {
+			return nil, ErrObjectNotFound
+		}
+		merged, err := mergePatch(prev, data)
+		if err != nil {
+			return nil, err
+		}
+		d.Objects[id] = merged
+	case OpDelete:
+		if !exists {
+			return nil, ErrObjectNotFound
+		}
+		delete(d.Objects, id)
+	default:
+		return nil, ErrUnknownOp
+	}
+	return prev, nil
+}
+
+// Inverse returns the mutation that reverts opType/data, given the object as
+// it was before the mutation.
+func Inverse(opType string, data, prev json.RawMessage) (string, json.RawMessage, error) {
+	id, err := ObjectID(data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch opType {
+	case OpAdd, OpStroke:
+		if prev != nil {
+			// It replaced an existing object; put that one back.
+			return OpAdd, prev, nil
+		}
+		body, err := json.Marshal(map[string]string{"id": id})
+		return OpDelete, body, err
+	case OpUpdate:
+		patch, err := revertPatch(prev, data)
+		return OpUpdate, patch, err
+	case OpDelete:
+		return OpAdd, prev, nil
+	default:
+		return "", nil, ErrUnknownOp
+	}
+}
+
+// mergePatch applies the top-level fields of patch to object; a null field
+// removes it.
+func mergePatch(object, patch json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(object, &fields); err != nil {
+		return nil, fmt.Errorf("invalid object: %w", err)
+	}
+	var changes map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+	for key, value := range changes {
+		if string(value) == "null" {
+			delete(fields, key)
+		} else {
+			fields[key] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// revertPatch builds the patch that restores the fields touched by patch to
+// their values in prev.
+func revertPatch(prev, patch json.RawMessage) (json.RawMessage, error) {
+	var before map[string]json.RawMessage
+	if err := json.Unmarshal(prev, &before); err != nil {
+		return nil, fmt.Errorf("invalid object: %w", err)
+	}
+	var changes map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+	revert := make(map[string]json.RawMessage, len(changes))
+	for key := range changes {
+		if value, ok := before[key]; ok {
+			revert[key] = value
+		} else {
+			revert[key] = json.RawMessage("null")
+		}
+	}
+	revert["id"] = before["id"]
+	return json.Marshal(revert)
+}
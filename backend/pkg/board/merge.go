@@ -0,0 +1,57 @@
+package board
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Conflict is an object that both sides of a merge changed differently. A
+// nil side means the object is missing there.
+type Conflict struct {
+	ID     string          `json:"id"`
+	Base   json.RawMessage `json:"base"`
+	Ours   json.RawMessage `json:"ours"`
+	Theirs json.RawMessage `json:"theirs"`
+}
+
+// Merge combines the changes ours and theirs each made to base, object by
+// object. An object changed on one side only takes that side; an object
+// changed the same way on both is taken once. Objects changed differently
+// on both sides are reported as conflicts, sorted by ID, and keep ours in
+// the merged document.
+func Merge(base, ours, theirs *Document) (*Document, []Conflict) {
+	merged := New()
+	var conflicts []Conflict
+
+	ids := make(map[string]bool, len(ours.Objects)+len(theirs.Objects))
+	for _, doc := range []*Document{base, ours, theirs} {
+		for id := range doc.Objects {
+			ids[id] = true
+		}
+	}
+	for id := range ids {
+		b, o, t := base.Objects[id], ours.Objects[id], theirs.Objects[id]
+		result := o
+		switch {
+		case sameVersion(o, t), sameVersion(b, t):
+		case sameVersion(b, o):
+			result = t
+		default:
+			conflicts = append(conflicts, Conflict{ID: id, Base: b, Ours: o, Theirs: t})
+		}
+		if result != nil {
+			merged.Objects[id] = result
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].ID < conflicts[j].ID })
+	return merged, conflicts
+}
+
+// sameVersion is sameObject for objects that may be missing.
+func sameVersion(a, b json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return sameObject(a, b)
+}
@@ -0,0 +1,173 @@
+package board
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"math"
+)
+
+// Highlight kinds drawn by Overlay.
+const (
+	HighlightAdded    = "added"
+	HighlightRemoved  = "removed"
+	HighlightModified = "modified"
+	// HighlightPrevious marks where a modified object used to be.
+	HighlightPrevious = "previous"
+)
+
+var highlightStyles = map[string]string{
+	HighlightAdded:    `stroke="#2e7d32" fill="#2e7d32" fill-opacity="0.15"`,
+	HighlightRemoved:  `stroke="#c62828" fill="#c62828" fill-opacity="0.15"`,
+	HighlightModified: `stroke="#f9a825" fill="#f9a825" fill-opacity="0.15"`,
+	HighlightPrevious: `stroke="#f9a825" fill="none" stroke-dasharray="6 4"`,
+}
+
+// Highlight is one object to mark on an overlay.
+type Highlight struct {
+	Kind   string
+	Object json.RawMessage
+}
+
+// Box is an axis-aligned rectangle in board coordinates.
+type Box struct {
+	X, Y, Width, Height float64
+}
+
+func (b Box) union(other Box) Box {
+	x := math.Min(b.X, other.X)
+	y := math.Min(b.Y, other.Y)
+	return Box{
+		X:      x,
+		Y:      y,
+		Width:  math.Max(b.X+b.Width, other.X+other.Width) - x,
+		Height: math.Max(b.Y+b.Height, other.Y+other.Height) - y,
+	}
+}
+
+// Bounds works out the bounding box of an object from its geometry: x/y
+// with width/height, x1/y1/x2/y2, cx/cy with r, or a list of points given
+// as {x, y} objects, [x, y] pairs or a flat list of coordinates. ok is
+// false for objects without any of these.
+func Bounds(object json.RawMessage) (box Box, ok bool) {
+	var fields struct {
+		X, Y, Width, Height *float64
+		X1, Y1, X2, Y2      *float64
+		CX, CY, R           *float64
+		Points              json.RawMessage
+	}
+	if err := json.Unmarshal(object, &fields); err != nil {
+		return Box{}, false
+	}
+
+	var xs, ys []float64
+	add := func(x, y float64) {
+		xs = append(xs, x)
+		ys = append(ys, y)
+	}
+	switch {
+	case fields.CX != nil && fields.CY != nil && fields.R != nil:
+		r := *fields.R
+		add(*fields.CX-r, *fields.CY-r)
+		add(*fields.CX+r, *fields.CY+r)
+	case fields.X1 != nil && fields.Y1 != nil && fields.X2 != nil && fields.Y2 != nil:
+		add(*fields.X1, *fields.Y1)
+		add(*fields.X2, *fields.Y2)
+	case fields.X != nil && fields.Y != nil:
+		add(*fields.X, *fields.Y)
+		if fields.Width != nil && fields.Height != nil {
+			add(*fields.X+*fields.Width, *fields.Y+*fields.Height)
+		}
+	}
+	for _, point := range points(fields.Points) {
+		add(point[0], point[1])
+	}
+	if len(xs) == 0 {
+		return Box{}, false
+	}
+
+	minX, maxX, minY, maxY := xs[0], xs[0], ys[0], ys[0]
+	for i := range xs {
+		minX, maxX = math.Min(minX, xs[i]), math.Max(maxX, xs[i])
+		minY, maxY = math.Min(minY, ys[i]), math.Max(maxY, ys[i])
+	}
+	return Box{X: minX, Y: minY, Width: maxX - minX, Height: maxY - minY}, true
+}
+
+// points reads a list of points in any of the shapes Bounds accepts.
+func points(data json.RawMessage) [][2]float64 {
+	if len(data) == 0 {
+		return nil
+	}
+	var objects []struct{ X, Y float64 }
+	if json.Unmarshal(data, &objects) == nil {
+		result := make([][2]float64, len(objects))
+		for i, p := range objects {
+			result[i] = [2]float64{p.X, p.Y}
+		}
+		return result
+	}
+	var pairs [][2]float64
+	if json.Unmarshal(data, &pairs) == nil {
+		return pairs
+	}
+	var flat []float64
+	if json.Unmarshal(data, &flat) == nil {
+		result := make([][2]float64, 0, len(flat)/2)
+		for i := 0; i+1 < len(flat); i += 2 {
+			result = append(result, [2]float64{flat[i], flat[i+1]})
+		}
+		return result
+	}
+	return nil
+}
+
+// overlayPadding keeps highlight outlines clear of the image edge and
+// gives points and lines a visible size.
+const overlayPadding = 8
+
+// Overlay renders the highlights as a transparent SVG in board coordinates,
+// meant to be laid over the board: each object is outlined by its bounding
+// box in the colour of its kind. Objects without geometry are skipped.
+func Overlay(highlights []Highlight) []byte {
+	var body bytes.Buffer
+	var view Box
+	drawn := 0
+	for _, h := range highlights {
+		style, ok := highlightStyles[h.Kind]
+		if !ok {
+			continue
+		}
+		box, ok := Bounds(h.Object)
+		if !ok {
+			continue
+		}
+		box = Box{
+			X:      box.X - overlayPadding/2,
+			Y:      box.Y - overlayPadding/2,
+			Width:  box.Width + overlayPadding,
+			Height: box.Height + overlayPadding,
+		}
+		if drawn == 0 {
+			view = box
+		} else {
+			view = view.union(box)
+		}
+		drawn++
+
+		id, _ := ObjectID(h.Object)
+		fmt.Fprintf(&body, `<rect class="%s" data-id="%s" x="%g" y="%g" width="%g" height="%g" stroke-width="2" %s/>`+"\n",
+			h.Kind, html.EscapeString(id), box.X, box.Y, box.Width, box.Height, style)
+	}
+	if drawn > 0 {
+		view = Box{X: view.X - overlayPadding, Y: view.Y - overlayPadding, Width: view.Width + 2*overlayPadding, Height: view.Height + 2*overlayPadding}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="%g %g %g %g" width="%g" height="%g">`+"\n",
+		view.X, view.Y, view.Width, view.Height, view.Width, view.Height)
+	out.Write(body.Bytes())
+	out.WriteString("</svg>\n")
+	return out.Bytes()
+}
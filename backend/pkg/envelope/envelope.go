@@ -0,0 +1,204 @@
+package envelope
+
+// This file implements envelope encryption: data is encrypted with a data key
+// of its own, and only the data key is encrypted ("wrapped") with a master
+// key. Rotating a master key then means re-wrapping data keys, not
+// re-encrypting data.
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+)
+
+// KeySize is the size of master and data keys: AES-256.
+const KeySize = 32
+
+var (
+	ErrUnknownMasterKey = errors.New("unknown master key")
+	ErrDecrypt          = errors.New("decryption failed")
+)
+
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+// Keyring holds the master keys. The first one wraps new data keys; the
+// others only unwrap data keys wrapped before a rotation.
+type Keyring struct {
+	keys []masterKey
+}
+
+// ParseKeys reads base64-encoded master keys, separated by commas or
+// newlines, the current one first.
+func ParseKeys(list string) (*Keyring, error) {
+	fields := strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+	keyring := &Keyring{}
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" || strings.HasPrefix(field, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key: %w", err)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("master keys must be %d bytes, got %d", KeySize, len(key))
+		}
+		keyring.keys = append(keyring.keys, masterKey{id: keyID(key), key: key})
+	}
+	if len(keyring.keys) == 0 {
+		return nil, errors.New("no master key given")
+	}
+	return keyring, nil
+}
+
+// LoadKeyFile reads master keys from a file, one per line, the current one
+// first. Lines starting with # are comments.
+func LoadKeyFile(path string) (*Keyring, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key file: %w", err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	return ParseKeys(strings.Join(lines, "\n"))
+}
+
+// GenerateKey returns a new random key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// keyID names a master key without revealing it.
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// CurrentKeyID is the ID of the master key that wraps new data keys.
+func (k *Keyring) CurrentKeyID() string {
+	return k.keys[0].id
+}
+
+// Wrap encrypts a data key with the current master key and returns it with
+// the master key's ID.
+func (k *Keyring) Wrap(dataKey []byte) ([]byte, string, error) {
+	current := k.keys[0]
+	wrapped, err := seal(current.key, dataKey, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return wrapped, current.id, nil
+}
+
+// Unwrap decrypts a data key wrapped with the master key masterKeyID.
+func (k *Keyring) Unwrap(wrapped []byte, masterKeyID string) ([]byte, error) {
+	for _, master := range k.keys {
+		if master.id == masterKeyID {
+			return open(master.key, wrapped)
+		}
+	}
+	return nil, fmt.Errorf("%w %s", ErrUnknownMasterKey, masterKeyID)
+}
+
+// subkey derives a key for one purpose from a data key.
+func subkey(dataKey []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// ContentID is a keyed hash of data: equal data under the same data key has
+// the same ID, but the ID reveals nothing to someone without the key.
+func ContentID(dataKey, data []byte) string {
+	mac := ContentHash(dataKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ContentHash computes ContentID over data written to it, for data read
+// as a stream.
+func ContentHash(dataKey []byte) hash.Hash {
+	return hmac.New(sha256.New, subkey(dataKey, "content-id"))
+}
+
+// Encrypt seals data with a data key using AES-GCM. The nonce is derived
+// from the data, so equal data encrypts to equal ciphertext and can still
+// be stored once.
+func Encrypt(dataKey, data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, subkey(dataKey, "nonce"))
+	mac.Write(data)
+	return seal(subkey(dataKey, "encryption"), data, mac.Sum(nil))
+}
+
+// Decrypt opens data sealed by Encrypt.
+func Decrypt(dataKey, ciphertext []byte) ([]byte, error) {
+	return open(subkey(dataKey, "encryption"), ciphertext)
+}
+
+// seal encrypts with AES-GCM and prepends the nonce, taken from the start
+// of nonceSource or random if it is nil.
+func seal(key, plaintext, nonceSource []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if nonceSource != nil {
+		copy(nonce, nonceSource)
+	} else if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
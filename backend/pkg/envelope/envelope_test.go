@@ -0,0 +1,121 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	dataKey := testKey(1)
+	for _, data := range [][]byte{nil, []byte("x"), bytes.Repeat([]byte("board data "), 10000)} {
+		sealed, err := Encrypt(dataKey, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 0 && bytes.Contains(sealed, data) {
+			t.Fatal("ciphertext holds the plaintext")
+		}
+		again, _ := Encrypt(dataKey, data)
+		if !bytes.Equal(sealed, again) {
+			t.Fatal("equal data encrypted differently")
+		}
+		opened, err := Decrypt(dataKey, sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(opened, data) {
+			t.Fatalf("decrypted %d bytes, want the %d encrypted", len(opened), len(data))
+		}
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	dataKey := testKey(1)
+	sealed, err := Encrypt(dataKey, []byte("the quick brown fox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tc := range map[string]struct {
+		key        []byte
+		ciphertext []byte
+	}{
+		"wrong key":            {testKey(2), sealed},
+		"flipped nonce":        {dataKey, flip(sealed, 0)},
+		"flipped body":         {dataKey, flip(sealed, len(sealed)/2)},
+		"flipped tag":          {dataKey, flip(sealed, len(sealed)-1)},
+		"truncated":            {dataKey, sealed[:len(sealed)-1]},
+		"shorter than a nonce": {dataKey, sealed[:4]},
+		"empty":                {dataKey, nil},
+	} {
+		if _, err := Decrypt(tc.key, tc.ciphertext); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: got %v, want ErrDecrypt", name, err)
+		}
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	old := base64.StdEncoding.EncodeToString(testKey(1))
+	current := base64.StdEncoding.EncodeToString(testKey(2))
+	before, err := ParseKeys(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := ParseKeys(current + ",\n# retired\n" + old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataKey, _ := GenerateKey()
+	wrapped, masterKeyID, err := before.Wrap(dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if masterKeyID == after.CurrentKeyID() {
+		t.Fatal("rotated keyring still wraps with the old key")
+	}
+	unwrapped, err := after.Unwrap(wrapped, masterKeyID)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Fatalf("unwrapping with the old key after rotation: %v", err)
+	}
+
+	rewrapped, currentID, err := after.Wrap(dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := before.Unwrap(rewrapped, currentID); !errors.Is(err, ErrUnknownMasterKey) {
+		t.Fatalf("unwrapping with a keyring that lacks the key: %v, want ErrUnknownMasterKey", err)
+	}
+	if _, err := after.Unwrap(flip(rewrapped, 20), currentID); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("unwrapping a tampered key: %v, want ErrDecrypt", err)
+	}
+}
+
+func TestParseKeysRejectsBadKeys(t *testing.T) {
+	for name, list := range map[string]string{
+		"empty":      "",
+		"comments":   "# nothing here",
+		"not base64": "!!!",
+		"too short":  base64.StdEncoding.EncodeToString(testKey(1)[:16]),
+	} {
+		if _, err := ParseKeys(list); err == nil {
+			t.Errorf("%s: parsed", name)
+		}
+	}
+	if _, err := ParseKeys(strings.Repeat(base64.StdEncoding.EncodeToString(testKey(1))+"\r\n", 2)); err != nil {
+		t.Fatalf("keys separated by CRLF: %v", err)
+	}
+}
+
+// flip returns a copy of data with the byte at i changed.
+func flip(data []byte, i int) []byte {
+	changed := append([]byte(nil), data...)
+	changed[i] ^= 0x01
+	return changed
+}
@@ -0,0 +1,215 @@
+package envelope
+
+// This file implements encryption of streams too large to hold in memory:
+// the plaintext is split into segments that are sealed one at a time, each
+// with its position and whether it is the last one bound into its nonce, so
+// that segments cannot be reordered, dropped or truncated unnoticed.
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+)
+
+const (
+	// segmentSize is how much plaintext each segment holds.
+	segmentSize = 64 << 10
+	// SaltSize is the size of the salt heading a stream.
+	SaltSize = 32
+)
+
+// StreamSalt hashes the plaintext of a stream into the salt to pass to
+// NewEncrypter. Like the nonce of Encrypt, the salt is derived from the
+// plaintext, so equal plaintext encrypts to equal ciphertext, while each
+// distinct plaintext is sealed with a key of its own.
+func StreamSalt(dataKey []byte) hash.Hash {
+	return hmac.New(sha256.New, subkey(dataKey, "stream-salt"))
+}
+
+// streamKey derives the key sealing the segments of one stream.
+func streamKey(dataKey, salt []byte) []byte {
+	mac := hmac.New(sha256.New, subkey(dataKey, "stream"))
+	mac.Write(salt)
+	return mac.Sum(nil)
+}
+
+// segmentNonce is the nonce of the segment at index: the index, then
+// whether it is the last segment.
+func segmentNonce(nonce []byte, index uint64, last bool) []byte {
+	for i := range nonce {
+		nonce[i] = 0
+	}
+	binary.BigEndian.PutUint64(nonce, index)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+type encrypter struct {
+	gcm     cipher.AEAD
+	w       io.Writer
+	nonce   []byte
+	pending []byte
+	sealed  []byte
+	index   uint64
+	err     error
+}
+
+// NewEncrypter returns a writer that encrypts what is written to it into w
+// with a data key. salt must be the sum of StreamSalt over everything that
+// will be written. The stream is only complete once the writer is closed.
+func NewEncrypter(dataKey, salt []byte, w io.Writer) (io.WriteCloser, error) {
+	if len(salt) != SaltSize {
+		return nil, errors.New("invalid stream salt")
+	}
+	gcm, err := newGCM(streamKey(dataKey, salt))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &encrypter{
+		gcm:     gcm,
+		w:       w,
+		nonce:   make([]byte, gcm.NonceSize()),
+		pending: make([]byte, 0, segmentSize),
+		sealed:  make([]byte, 0, segmentSize+gcm.Overhead()),
+	}, nil
+}
+
+func (e *encrypter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if e.err != nil {
+			return written, e.err
+		}
+		// A full segment is only sealed once more data follows; until
+		// then it may be the last.
+		if len(e.pending) == segmentSize {
+			e.flush(false)
+			continue
+		}
+		n := copy(e.pending[len(e.pending):segmentSize], p)
+		e.pending = e.pending[:len(e.pending)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, e.err
+}
+
+// Close seals the last segment. It does not close the underlying writer.
+func (e *encrypter) Close() error {
+	if e.err == nil {
+		e.flush(true)
+		if e.err == nil {
+			e.err = errors.New("encrypter is closed")
+			return nil
+		}
+	}
+	return e.err
+}
+
+func (e *encrypter) flush(last bool) {
+	nonce := segmentNonce(e.nonce, e.index, last)
+	e.sealed = e.gcm.Seal(e.sealed[:0], nonce, e.pending, nil)
+	if _, err := e.w.Write(e.sealed); err != nil {
+		e.err = err
+		return
+	}
+	e.pending = e.pending[:0]
+	e.index++
+}
+
+type decrypter struct {
+	gcm     cipher.AEAD
+	r       *bufio.Reader
+	nonce   []byte
+	sealed  []byte
+	plain   []byte
+	pending []byte
+	index   uint64
+	done    bool
+	err     error
+}
+
+// NewDecrypter returns a reader of the plaintext of a stream written by
+// NewEncrypter. It only returns data that has been authenticated, and fails
+// with ErrDecrypt on a segment that does not authenticate or a stream that
+// was cut short.
+func NewDecrypter(dataKey []byte, r io.Reader) (io.Reader, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrDecrypt
+		}
+		return nil, err
+	}
+	gcm, err := newGCM(streamKey(dataKey, salt))
+	if err != nil {
+		return nil, err
+	}
+	return &decrypter{
+		gcm:    gcm,
+		r:      bufio.NewReaderSize(r, segmentSize+gcm.Overhead()),
+		nonce:  make([]byte, gcm.NonceSize()),
+		sealed: make([]byte, segmentSize+gcm.Overhead()),
+		plain:  make([]byte, 0, segmentSize),
+	}, nil
+}
+
+func (d *decrypter) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.next()
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// next opens the next segment. A segment is the last one when the stream
+// ends with it.
+func (d *decrypter) next() {
+	n, err := io.ReadFull(d.r, d.sealed)
+	last := false
+	switch {
+	case err == nil:
+		if _, err := d.r.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			d.err = err
+			return
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case errors.Is(err, io.EOF):
+		// The last segment never arrived.
+		d.err = ErrDecrypt
+		return
+	default:
+		d.err = err
+		return
+	}
+
+	nonce := segmentNonce(d.nonce, d.index, last)
+	plain, err := d.gcm.Open(d.plain[:0], nonce, d.sealed[:n], nil)
+	if err != nil {
+		d.err = ErrDecrypt
+		return
+	}
+	d.pending = plain
+	d.index++
+	d.done = last
+}
@@ -0,0 +1,146 @@
+package envelope
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// encryptStream encrypts data written in chunks of chunk bytes.
+func encryptStream(t *testing.T, dataKey, data []byte, chunk int) []byte {
+	t.Helper()
+	salt := StreamSalt(dataKey)
+	salt.Write(data)
+	var out bytes.Buffer
+	w, err := NewEncrypter(dataKey, salt.Sum(nil), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rest := data; len(rest) > 0; {
+		n := chunk
+		if n > len(rest) {
+			n = len(rest)
+		}
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func decryptStream(dataKey, sealed []byte) ([]byte, error) {
+	r, err := NewDecrypter(dataKey, bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func randomData(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	return data
+}
+
+const overhead = 16
+
+func TestStreamRoundTrip(t *testing.T) {
+	dataKey := testKey(1)
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 2 * segmentSize, 3*segmentSize + 5} {
+		for _, chunk := range []int{1000, segmentSize, 5 * segmentSize} {
+			t.Run(fmt.Sprintf("size=%d/chunk=%d", size, chunk), func(t *testing.T) {
+				data := randomData(size)
+				sealed := encryptStream(t, dataKey, data, chunk)
+
+				// Every stream has at least one segment, the last.
+				segments := (size + segmentSize - 1) / segmentSize
+				if segments == 0 {
+					segments = 1
+				}
+				if want := SaltSize + size + segments*overhead; len(sealed) != want {
+					t.Fatalf("sealed %d bytes, want %d for %d segments", len(sealed), want, segments)
+				}
+				if again := encryptStream(t, dataKey, data, 777); !bytes.Equal(again, sealed) {
+					t.Fatal("equal data encrypted differently")
+				}
+
+				opened, err := decryptStream(dataKey, sealed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(opened, data) {
+					t.Fatalf("decrypted %d bytes, want the %d encrypted", len(opened), len(data))
+				}
+			})
+		}
+	}
+}
+
+func TestStreamRejectsTampering(t *testing.T) {
+	dataKey := testKey(1)
+	data := randomData(2*segmentSize + 10)
+	sealed := encryptStream(t, dataKey, data, segmentSize)
+	sealedSegment := segmentSize + overhead
+	first := sealed[SaltSize : SaltSize+sealedSegment]
+	second := sealed[SaltSize+sealedSegment : SaltSize+2*sealedSegment]
+	last := sealed[SaltSize+2*sealedSegment:]
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(append([][]byte{sealed[:SaltSize]}, parts...), nil)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		sealed []byte
+		// intact is how much plaintext comes out before the damage.
+		intact int
+	}{
+		{"wrong key", nil, 0},
+		{"flipped salt", flip(sealed, 3), 0},
+		{"flipped first segment", flip(sealed, SaltSize+10), 0},
+		{"flipped second segment", flip(sealed, SaltSize+sealedSegment+10), segmentSize},
+		{"flipped last byte", flip(sealed, len(sealed)-1), 2 * segmentSize},
+		{"dropped last segment", join(first, second), segmentSize},
+		{"dropped middle segment", join(first, last), segmentSize},
+		{"swapped segments", join(second, first, last), 0},
+		{"truncated inside a segment", sealed[:len(sealed)-5], 2 * segmentSize},
+		{"appended bytes", append(append([]byte(nil), sealed...), 0), 2 * segmentSize},
+		{"appended segment", join(first, second, last, last), 2 * segmentSize},
+		{"salt only", sealed[:SaltSize], 0},
+		{"shorter than the salt", sealed[:SaltSize-1], 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			key, input := dataKey, tc.sealed
+			if input == nil {
+				key, input = testKey(2), sealed
+			}
+			r, err := NewDecrypter(key, bytes.NewReader(input))
+			if err != nil {
+				if !errors.Is(err, ErrDecrypt) {
+					t.Fatalf("NewDecrypter = %v, want ErrDecrypt", err)
+				}
+				return
+			}
+			opened, err := io.ReadAll(r)
+			if !errors.Is(err, ErrDecrypt) {
+				t.Fatalf("read = %v, want ErrDecrypt", err)
+			}
+			// Only authenticated data comes out.
+			if len(opened) != tc.intact || !bytes.Equal(opened, data[:len(opened)]) {
+				t.Fatalf("returned %d bytes before failing, want the first %d", len(opened), tc.intact)
+			}
+		})
+	}
+}
+
+func TestEncrypterRejectsBadSalt(t *testing.T) {
+	if _, err := NewEncrypter(testKey(1), make([]byte, SaltSize-1), io.Discard); err == nil {
+		t.Fatal("accepted a short salt")
+	}
+}
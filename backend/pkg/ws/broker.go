@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Broker carries room traffic between server instances so that clients
+// connected to different replicas share the same rooms. Publish delivers to
+// every subscriber of the room, including the publishing instance; the hub
+// skips its own envelopes. Per-user topics (see users.go) share the same
+// key space as artboard IDs. A broker that may have lost payloads, e.g.
+// while reconnecting, calls deliver with nil so that rooms can ask the
+// other instances to resynchronize.
+type Broker interface {
+	Publish(artboardID string, payload []byte) error
+	Subscribe(artboardID string, deliver func(payload []byte)) (unsubscribe func(), err error)
+	// NextSeq returns the next operation sequence number for the room.
+	NextSeq(artboardID string) (int64, error)
+}
+
+// Envelope kinds exchanged through the broker.
+const (
+	kindMessage     = "message"
+	kindJoin        = "join"
+	kindLeave       = "leave"
+	kindSyncRequest = "sync_request"
+	kindMembers     = "members"
+)
+
+type envelope struct {
+	Origin  string          `json:"origin"`
+	Kind    string          `json:"kind"`
+	Type    string          `json:"type,omitempty"`
+	Message json.RawMessage `json:"message,omitempty"`
+	Route   route           `json:"route"`
+	Peers   []Peer          `json:"peers,omitempty"`
+	// Object locks held on the sending instance, with kindMembers.
+	Locks []*objectLock `json:"locks,omitempty"`
+}
+
+// Peer is one connection present in a room, on any instance.
+type Peer struct {
+	ConnectionID string `json:"connection_id"`
+	UserID       string `json:"user_id"`
+	Instance     string `json:"instance"`
+}
+
+type memoryBroker struct {
+	mutex       sync.Mutex
+	subscribers map[string]map[int]func([]byte)
+	nextID      int
+	sequences   map[string]int64
+}
+
+// NewMemoryBroker returns a Broker for a single process. Hubs sharing one
+// memory broker behave like separate instances sharing a Postgres broker.
+func NewMemoryBroker() Broker {
+	return &memoryBroker{
+		subscribers: make(map[string]map[int]func([]byte)),
+		sequences:   make(map[string]int64),
+	}
+}
+
+func (b *memoryBroker) Publish(artboardID string, payload []byte) error {
+	b.mutex.Lock()
+	deliveries := make([]func([]byte), 0, len(b.subscribers[artboardID]))
+	for _, deliver := range b.subscribers[artboardID] {
+		deliveries = append(deliveries, deliver)
+	}
+	b.mutex.Unlock()
+
+	for _, deliver := range deliveries {
+		deliver(payload)
+	}
+	return nil
+}
+
+func (b *memoryBroker) Subscribe(artboardID string, deliver func([]byte)) (func(), error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.subscribers[artboardID]; !ok {
+		b.subscribers[artboardID] = make(map[int]func([]byte))
+	}
+	id := b.nextID
+	b.nextID++
+	b.subscribers[artboardID][id] = deliver
+
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.subscribers[artboardID], id)
+		if len(b.subscribers[artboardID]) == 0 {
+			delete(b.subscribers, artboardID)
+		}
+	}, nil
+}
+
+func (b *memoryBroker) NextSeq(artboardID string) (int64, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.sequences[artboardID]++
+	return b.sequences[artboardID], nil
+}
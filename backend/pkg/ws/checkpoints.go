@@ -0,0 +1,194 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/board"
+
+	"github.com/google/uuid"
+)
+
+// A Checkpointer saves a snapshot of a board as of seq, e.g. as an
+// automatic version. Rooms call it on their own goroutine after
+// Config.CheckpointEvery local operations, after Config.CheckpointInterval
+// with any, and when the last client leaves.
+type Checkpointer func(artboardID string, seq int64, data []byte) error
+
+// SetCheckpointer installs checkpointer. It must be called before the hub
+// starts serving connections.
+func (h *Hub) SetCheckpointer(checkpointer Checkpointer) {
+	h.checkpointer = checkpointer
+}
+
+// A CheckpointLoader returns the latest snapshot saved of a board and the
+// sequence number it is as of, or domain.ErrNotFound if there is none.
+// Rooms start from it and only replay the operations logged since.
+type CheckpointLoader func(artboardID string) ([]byte, int64, error)
+
+// SetCheckpointLoader installs loader. It must be called before the hub
+// starts serving connections; without one rooms replay the whole log.
+func (h *Hub) SetCheckpointLoader(loader CheckpointLoader) {
+	h.checkpointLoader = loader
+}
+
+// loadCheckpoint starts the room's document from the latest snapshot.
+func (r *room) loadCheckpoint() {
+	if r.hub.checkpointLoader == nil {
+		return
+	}
+	data, seq, err := r.hub.checkpointLoader(r.artboardID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading checkpoint of %s: %v", r.artboardID, err)
+		return
+	}
+	doc, err := board.Parse(data)
+	if err != nil {
+		log.Printf("Error parsing checkpoint of %s: %v", r.artboardID, err)
+		return
+	}
+	r.doc, r.seq = doc, seq
+}
+
+// countCheckpoint notes a local operation and checkpoints when enough of
+// them have piled up.
+func (r *room) countCheckpoint() {
+	r.uncheckpointed++
+	if every := r.hub.config.CheckpointEvery; every > 0 && r.uncheckpointed >= every {
+		r.checkpoint()
+	}
+}
+
+// checkpoint hands a snapshot of the document to the hub's checkpointer.
+func (r *room) checkpoint() {
+	if r.hub.checkpointer == nil || r.uncheckpointed == 0 {
+		return
+	}
+	data, err := r.doc.Marshal()
+	if err != nil {
+		log.Printf("Error marshaling document of %s: %v", r.artboardID, err)
+		return
+	}
+	r.uncheckpointed = 0
+
+	artboardID, seq, checkpointer := r.artboardID, r.seq, r.hub.checkpointer
+	go func() {
+		if err := checkpointer(artboardID, seq, data); err != nil {
+			log.Printf("Error checkpointing %s at %d: %v", artboardID, seq, err)
+		}
+	}()
+}
+
+// patchRequest is a change to a board made by the server, such as
+// restoring a version (see Hub.Patch).
+type patchRequest struct {
+	userID string
+	// from is nil to turn the whole board into to.
+	from, to *board.Document
+	reply    chan patchResult
+}
+
+type patchResult struct {
+	data []byte
+	seq  int64
+	// need is set instead when the patch takes more sequence numbers than
+	// were reserved for it.
+	need int
+	err  error
+}
+
+// Patch makes the changes that turn the document from into to on a board,
+// or turns the whole board into to if from is nil, as if a client had sent
+// them: the board's room computes the operations against the board as it
+// is, then applies, logs and relays them to everyone. Either every
+// operation applies or none does. It returns the board after the change
+// and its sequence number.
+func (h *Hub) Patch(artboardID, userID string, from, to []byte) ([]byte, int64, error) {
+	req := &patchRequest{userID: userID, reply: make(chan patchResult, 1)}
+	var err error
+	if from != nil {
+		if req.from, err = board.Parse(from); err != nil {
+			return nil, 0, err
+		}
+	}
+	if req.to, err = board.Parse(to); err != nil {
+		return nil, 0, err
+	}
+
+	r, err := h.acquire(artboardID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer h.release(r)
+
+	// The room reports how many sequence numbers the patch takes; the
+	// board may change while they are reserved, so it may ask again.
+	count := 0
+	for {
+		r.sequence(seqRequest{event: roomEvent{patch: req}, count: count})
+		result := <-req.reply
+		if result.need == 0 {
+			return result.data, result.seq, result.err
+		}
+		count = result.need
+	}
+}
+
+// applyPatch serves a patchRequest with the sequence numbers reserved for
+// it.
+func (r *room) applyPatch(req *patchRequest, seqs []int64) {
+	from := req.from
+	if from == nil {
+		from = r.doc
+	}
+	mutations, err := board.Patch(from, req.to)
+	if err != nil {
+		req.reply <- patchResult{err: err}
+		return
+	}
+	if len(mutations) > len(seqs) {
+		req.reply <- patchResult{need: len(mutations)}
+		return
+	}
+
+	// Try the operations on a copy first, so a patch that does not apply
+	// leaves the board untouched.
+	scratch := board.New()
+	for id, object := range r.doc.Objects {
+		scratch.Objects[id] = object
+	}
+	for _, mutation := range mutations {
+		if _, err := scratch.Apply(mutation.Type, mutation.Data); err != nil {
+			req.reply <- patchResult{err: fmt.Errorf("failed to apply %s: %w", mutation.Type, err)}
+			return
+		}
+	}
+
+	for i, mutation := range mutations {
+		msg := Message{Type: mutation.Type, ArtboardID: r.artboardID, UserID: req.userID, OpID: uuid.New().String(), Seq: seqs[i], Data: mutation.Data}
+		op, err := r.apply(&msg)
+		if err != nil {
+			req.reply <- patchResult{err: fmt.Errorf("failed to apply %s: %w", mutation.Type, err)}
+			return
+		}
+		r.persist(op)
+		r.countCheckpoint()
+
+		message, err := json.Marshal(msg)
+		if err != nil {
+			log.Printf("Error marshaling operation: %v", err)
+			continue
+		}
+		r.broadcast(message, msg.Type, route{})
+		r.relay(envelope{Kind: kindMessage, Type: msg.Type, Message: message})
+	}
+
+	data, err := r.doc.Marshal()
+	req.reply <- patchResult{data: data, seq: r.seq, err: err}
+}
@@ -0,0 +1,280 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type Client struct {
+	hub        *Hub
+	room       *room
+	conn       *websocket.Conn
+	send       chan *frame
+	codec      Codec
+	id         string
+	artboardID string
+	userID     string
+	closeOnce  sync.Once
+	limiter    *clientLimiter
+	// Whether the user may change the board, see EditPolicy.
+	canEdit bool
+
+	// Owned by the room goroutine.
+	dropped int
+
+	// Set once by teardown, read by writePump after send is closed.
+	teardownOnce sync.Once
+	closeCode    int
+	closeText    string
+}
+
+func (c *Client) peer() Peer {
+	return Peer{ConnectionID: c.id, UserID: c.userID, Instance: c.hub.instanceID}
+}
+
+// teardown closes the send channel so writePump can say goodbye with the
+// given close code. It is safe to call any number of times; only the room
+// goroutine calls it, which keeps it the sole writer to send.
+func (c *Client) teardown(code int, text string) {
+	c.teardownOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.send)
+	})
+}
+
+// closed records why the connection went away. Only the first reason counts.
+func (c *Client) closed(reason string) {
+	c.closeOnce.Do(func() {
+		c.hub.metrics.connectionClosed(reason)
+	})
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func readCloseReason(err error) string {
+	switch {
+	case websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived):
+		return CloseReasonClientClosed
+	case errors.Is(err, websocket.ErrReadLimit):
+		return CloseReasonTooLarge
+	case isTimeout(err):
+		return CloseReasonPongTimeout
+	default:
+		return CloseReasonReadError
+	}
+}
+
+func writeCloseReason(err error) string {
+	if isTimeout(err) {
+		return CloseReasonWriteTimeout
+	}
+	return CloseReasonWriteError
+}
+
+// readPump leaves closing the connection to writePump, so that anything
+// still queued, including the close frame, reaches the peer.
+func (c *Client) readPump() {
+	defer c.hub.leave(c)
+
+	config := c.hub.config
+	c.conn.SetReadLimit(config.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(config.PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(config.PongWait))
+	})
+
+	for {
+		frameType, payload, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("error: %v", err)
+			}
+			c.closed(readCloseReason(err))
+			break
+		}
+
+		// Text frames are always JSON so a binary client can still be
+		// driven by hand while debugging.
+		var codec Codec = jsonCodec{}
+		if frameType == websocket.BinaryMessage {
+			codec = msgpackCodec{}
+		}
+		msg, err := codec.Decode(payload)
+		if err != nil {
+			log.Printf("Error decoding message: %v", err)
+			continue
+		}
+
+		if verdict := c.allow(msg.Type); verdict != rateAllowed {
+			// Only the client's own excess counts against it; a busy
+			// room is nobody's violation.
+			if verdict == rateLimitedClient && c.limiter.violation(time.Now()) > config.MaxRateViolations {
+				c.room.post(roomEvent{kick: c, closeCode: websocket.ClosePolicyViolation, closeText: "rate limit exceeded", closeReason: CloseReasonRateLimited})
+				break
+			}
+			c.hub.metrics.rateLimited()
+			if mutationTypes[msg.Type] || msg.Type == TypeUndo || msg.Type == TypeRedo {
+				c.nack(msg.OpID, NackRateLimited)
+			} else {
+				c.warn("rate_limited", msg.Type)
+			}
+			continue
+		}
+
+		if signalingTypes[msg.Type] && len(msg.To) == 0 {
+			c.warn("missing_target", msg.Type)
+			continue
+		}
+
+		msg.UserID = c.userID
+		msg.ArtboardID = c.artboardID
+		msg.From = c.id
+		msg.Seq = 0
+
+		if editTypes[msg.Type] && !c.canEdit {
+			c.nack(msg.OpID, NackForbidden)
+			continue
+		}
+		if mutationTypes[msg.Type] {
+			c.mutate(msg)
+			continue
+		}
+		if msg.Type == TypeUndo || msg.Type == TypeRedo {
+			c.history(msg)
+			continue
+		}
+		if lockTypes[msg.Type] {
+			c.submit(msg)
+			continue
+		}
+		if handler, ok := c.hub.handlers[msg.Type]; ok {
+			c.handle(handler, msg)
+			continue
+		}
+		c.forward(msg, route{From: c.id, To: msg.To, P2P: msg.P2P})
+	}
+}
+
+// forward hands a stamped message to the local room and to the other
+// instances.
+func (c *Client) forward(msg *Message, rt route) {
+	message, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+
+	c.room.post(roomEvent{message: message, messageType: msg.Type, route: rt})
+	c.hub.publish(c.artboardID, envelope{Kind: kindMessage, Type: msg.Type, Message: message, Route: rt})
+}
+
+// allow applies the client's own limit for the message class and the
+// room-wide limit. A message either limit rejects counts against neither.
+func (c *Client) allow(messageType string) rateVerdict {
+	return c.room.limiter.allowWith(c.limiter.bucket(messageType), time.Now())
+}
+
+// warn sends a warning frame to this client only.
+func (c *Client) warn(code, messageType string) {
+	message, err := systemMessage("warning", c.artboardID, c.userID, map[string]string{"code": code, "message_type": messageType})
+	if err != nil {
+		log.Printf("Error marshaling warning: %v", err)
+		return
+	}
+	c.room.post(roomEvent{target: c, message: message, messageType: "warning"})
+}
+
+func (c *Client) writePump() {
+	config := c.hub.config
+	ticker := time.NewTicker(config.PingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(config.WriteWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeText))
+				return
+			}
+
+			payload, err := message.encode(c.codec)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			open, err := c.writeBatch(payload)
+			if err != nil {
+				c.closed(writeCloseReason(err))
+				return
+			}
+			if !open {
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeText))
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(config.WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.closed(writeCloseReason(err))
+				return
+			}
+		}
+	}
+}
+
+var newline = []byte{'\n'}
+
+// writeBatch writes payload and whatever else is already queued, up to
+// Config.BatchMaxMessages or Config.BatchMaxBytes, as a single frame. JSON
+// messages in a batch are separated by newlines; MessagePack values are
+// self-delimiting and simply concatenated. It reports false once send has
+// been closed.
+func (c *Client) writeBatch(payload []byte) (bool, error) {
+	config := c.hub.config
+	w, err := c.conn.NextWriter(c.codec.FrameType())
+	if err != nil {
+		return true, err
+	}
+	w.Write(payload)
+
+	open := true
+	count, size := 1, len(payload)
+	for count < config.BatchMaxMessages && size < config.BatchMaxBytes {
+		var message *frame
+		select {
+		case message, open = <-c.send:
+		default:
+		}
+		if message == nil {
+			break
+		}
+
+		next, err := message.encode(c.codec)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if c.codec.FrameType() == websocket.TextMessage {
+			w.Write(newline)
+		}
+		w.Write(next)
+		count++
+		size += len(next)
+	}
+
+	return open, w.Close()
+}
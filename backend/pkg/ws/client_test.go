@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// countingConn counts the bytes read off the wire.
+type countingConn struct {
+	net.Conn
+	read *int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(c.read, int64(n))
+	return n, err
+}
+
+// BenchmarkWriteBandwidth sends bursts of cursor moves to one client and
+// reports the bytes it received per message, with compression and
+// batching on and off.
+func BenchmarkWriteBandwidth(b *testing.B) {
+	const burst = 100
+	for _, mode := range []struct {
+		name     string
+		compress bool
+		batch    int
+	}{
+		{"plain", false, 1},
+		{"compressed", true, 1},
+		{"batched", false, 64},
+		{"compressed+batched", true, 64},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			config := DefaultConfig()
+			config.EnableCompression = mode.compress
+			config.BatchMaxMessages = mode.batch
+			hub := NewHub(config, NewMemoryBroker(), nil)
+			server := newTestServer(b, hub)
+
+			var read int64
+			dialer := websocket.Dialer{
+				EnableCompression: true,
+				NetDial: func(network, addr string) (net.Conn, error) {
+					conn, err := net.Dial(network, addr)
+					return countingConn{Conn: conn, read: &read}, err
+				},
+			}
+			conn, _, err := dialer.Dial(wsURL(server, "board", "alice"), nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer conn.Close()
+			readPeers(b, conn, 1)
+
+			hub.mutex.Lock()
+			r := hub.rooms["board"]
+			hub.mutex.Unlock()
+
+			messages := make([][]byte, burst)
+			for i := range messages {
+				messages[i] = []byte(fmt.Sprintf(`{"type":"cursor","artboard_id":"board","user_id":"bob","from":"client-%d","data":{"x":%d.5,"y":%d.25,"tool":"pen"}}`, i%10, i*7, i*3))
+			}
+
+			base := atomic.LoadInt64(&read)
+			frames := 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, message := range messages {
+					r.post(roomEvent{message: message, messageType: "cursor"})
+				}
+				for received := 0; received < burst; {
+					conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+					_, payload, err := conn.ReadMessage()
+					if err != nil {
+						b.Fatal(err)
+					}
+					received += bytes.Count(payload, newline) + 1
+					frames++
+				}
+			}
+			b.StopTimer()
+
+			total := float64(b.N * burst)
+			b.ReportMetric(float64(atomic.LoadInt64(&read)-base)/total, "wire-B/msg")
+			b.ReportMetric(float64(frames)/total, "frames/msg")
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Subprotocols a client may request in Sec-WebSocket-Protocol. Clients that
+// ask for none get JSON, which stays the easiest to debug.
+const (
+	SubprotocolJSON    = "gop2p.json"
+	SubprotocolMsgpack = "gop2p.msgpack"
+)
+
+// Codec converts between the hub's canonical JSON messages and the wire
+// format negotiated with a client.
+type Codec interface {
+	Subprotocol() string
+	FrameType() int
+	Encode(message []byte) ([]byte, error)
+	Decode(payload []byte) (*Message, error)
+}
+
+var codecs = map[string]Codec{
+	SubprotocolJSON:    jsonCodec{},
+	SubprotocolMsgpack: msgpackCodec{},
+}
+
+// codecFor picks the codec for the subprotocol agreed during the upgrade.
+func codecFor(subprotocol string) Codec {
+	if codec, ok := codecs[subprotocol]; ok {
+		return codec
+	}
+	return jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Subprotocol() string { return SubprotocolJSON }
+func (jsonCodec) FrameType() int      { return websocket.TextMessage }
+
+func (jsonCodec) Encode(message []byte) ([]byte, error) {
+	return message, nil
+}
+
+func (jsonCodec) Decode(payload []byte) (*Message, error) {
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// wireMessage is the MessagePack form of Message. Data is carried as a
+// native MessagePack value rather than embedded JSON text.
+type wireMessage struct {
+	Type       string      `msgpack:"t"`
+	ArtboardID string      `msgpack:"a,omitempty"`
+	UserID     string      `msgpack:"u,omitempty"`
+	From       string      `msgpack:"f,omitempty"`
+	To         Recipients  `msgpack:"o,omitempty"`
+	P2P        bool        `msgpack:"p,omitempty"`
+	OpID       string      `msgpack:"i,omitempty"`
+	Seq        int64       `msgpack:"s,omitempty"`
+	UndoOf     int64       `msgpack:"x,omitempty"`
+	RedoOf     int64       `msgpack:"y,omitempty"`
+	Data       interface{} `msgpack:"d,omitempty"`
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Subprotocol() string { return SubprotocolMsgpack }
+func (msgpackCodec) FrameType() int      { return websocket.BinaryMessage }
+
+func (msgpackCodec) Encode(message []byte) ([]byte, error) {
+	var msg Message
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return nil, err
+	}
+
+	wire := wireMessage{Type: msg.Type, ArtboardID: msg.ArtboardID, UserID: msg.UserID, From: msg.From, To: msg.To, P2P: msg.P2P, OpID: msg.OpID, Seq: msg.Seq, UndoOf: msg.UndoOf, RedoOf: msg.RedoOf}
+	if len(msg.Data) > 0 {
+		if err := json.Unmarshal(msg.Data, &wire.Data); err != nil {
+			return nil, err
+		}
+		if msg.Type == TypeStroke {
+			packStrokePoints(wire.Data)
+		}
+	}
+	return msgpack.Marshal(&wire)
+}
+
+func (msgpackCodec) Decode(payload []byte) (*Message, error) {
+	var wire wireMessage
+	if err := msgpack.Unmarshal(payload, &wire); err != nil {
+		return nil, err
+	}
+
+	msg := &Message{Type: wire.Type, ArtboardID: wire.ArtboardID, UserID: wire.UserID, From: wire.From, To: wire.To, P2P: wire.P2P, OpID: wire.OpID, Seq: wire.Seq, UndoOf: wire.UndoOf, RedoOf: wire.RedoOf}
+	if wire.Data != nil {
+		if wire.Type == TypeStroke {
+			if err := unpackStrokePoints(wire.Data); err != nil {
+				return nil, err
+			}
+		}
+		data, err := json.Marshal(wire.Data)
+		if err != nil {
+			return nil, err
+		}
+		msg.Data = data
+	}
+	return msg, nil
+}
+
+// Stroke points are the bulk of freehand traffic. In binary frames the
+// "points" array of [x, y] pairs is replaced by a byte string of zigzag
+// varints: the first point absolute, every later coordinate as the delta to
+// the previous one, all quantised to pointPrecision.
+const pointPrecision = 10
+
+var errBadPoints = errors.New("malformed stroke points")
+
+func packStrokePoints(data interface{}) {
+	fields, ok := data.(map[string]interface{})
+	if !ok {
+		return
+	}
+	points, ok := fields["points"].([]interface{})
+	if !ok {
+		return
+	}
+
+	buf := make([]byte, 0, len(points)*4)
+	var prevX, prevY int64
+	for _, p := range points {
+		pair, ok := p.([]interface{})
+		if !ok || len(pair) != 2 {
+			return
+		}
+		x, okX := pair[0].(float64)
+		y, okY := pair[1].(float64)
+		if !okX || !okY {
+			return
+		}
+		qx := int64(math.Round(x * pointPrecision))
+		qy := int64(math.Round(y * pointPrecision))
+		buf = binary.AppendVarint(buf, qx-prevX)
+		buf = binary.AppendVarint(buf, qy-prevY)
+		prevX, prevY = qx, qy
+	}
+	fields["points"] = buf
+}
+
+func unpackStrokePoints(data interface{}) error {
+	fields, ok := data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	buf, ok := fields["points"].([]byte)
+	if !ok {
+		return nil
+	}
+
+	points := make([][2]float64, 0, len(buf)/4)
+	var x, y int64
+	for len(buf) > 0 {
+		dx, n := binary.Varint(buf)
+		if n <= 0 {
+			return errBadPoints
+		}
+		buf = buf[n:]
+		dy, n := binary.Varint(buf)
+		if n <= 0 {
+			return errBadPoints
+		}
+		buf = buf[n:]
+		x, y = x+dx, y+dy
+		points = append(points, [2]float64{float64(x) / pointPrecision, float64(y) / pointPrecision})
+	}
+	fields["points"] = points
+	return nil
+}
+
+// frame is one outbound message shared by every recipient. Each wire
+// encoding is produced at most once, however many clients need it.
+type frame struct {
+	message     []byte
+	messageType string
+
+	mutex   sync.Mutex
+	encoded map[string][]byte
+}
+
+func newFrame(message []byte, messageType string) *frame {
+	return &frame{message: message, messageType: messageType}
+}
+
+func (f *frame) encode(codec Codec) ([]byte, error) {
+	if _, ok := codec.(jsonCodec); ok {
+		return f.message, nil
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if payload, ok := f.encoded[codec.Subprotocol()]; ok {
+		return payload, nil
+	}
+	payload, err := codec.Encode(f.message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s frame: %w", codec.Subprotocol(), err)
+	}
+	if f.encoded == nil {
+		f.encoded = make(map[string][]byte)
+	}
+	f.encoded[codec.Subprotocol()] = payload
+	return payload, nil
+}
@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestStrokePointsRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		points [][2]float64
+	}{
+		{"empty", [][2]float64{}},
+		{"one point", [][2]float64{{12.5, 7.25}}},
+		{"negative deltas", [][2]float64{{100, 100}, {90.5, 99.9}, {-20.3, 40}, {-20.4, -0.1}}},
+		{"negative coordinates", [][2]float64{{-5, -5}, {-6.2, -3.1}, {-1e3, -2e3}}},
+		{"large coordinates", [][2]float64{{1e9, -1e9}, {-1e9, 1e9}, {123456789.1, 0}}},
+		{"quantised", [][2]float64{{0.04, 0.05}, {-0.05, 1.26}, {3.14159, 2.71828}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, _ := json.Marshal(map[string]interface{}{"id": "s1", "color": "#000", "points": tc.points})
+			message, _ := json.Marshal(Message{Type: TypeStroke, ArtboardID: "board", Data: data})
+
+			payload, err := msgpackCodec{}.Encode(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := msgpackCodec{}.Decode(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got struct {
+				ID     string       `json:"id"`
+				Color  string       `json:"color"`
+				Points [][2]float64 `json:"points"`
+			}
+			if err := json.Unmarshal(msg.Data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != "s1" || got.Color != "#000" {
+				t.Fatalf("other fields changed: %s", msg.Data)
+			}
+			if got.Points == nil || len(got.Points) != len(tc.points) {
+				t.Fatalf("got %d points, want %d: %s", len(got.Points), len(tc.points), msg.Data)
+			}
+			for i, p := range tc.points {
+				for j := range p {
+					want := math.Round(p[j]*pointPrecision) / pointPrecision
+					if got.Points[i][j] != want {
+						t.Fatalf("point %d coordinate %d = %v, want %v (from %v)", i, j, got.Points[i][j], want, p[j])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStrokePointsAreDeltaEncoded(t *testing.T) {
+	// Small moves take one byte per coordinate, wherever the stroke is.
+	points := []interface{}{[]interface{}{50000.0, -50000.0}}
+	for i := 1; i <= 100; i++ {
+		points = append(points, []interface{}{50000.0 + float64(i%7) - 3, -50000.0 - float64(i%5)})
+	}
+	data := map[string]interface{}{"points": points}
+	packStrokePoints(data)
+	packed, ok := data["points"].([]byte)
+	if !ok {
+		t.Fatalf("points were not packed: %T", data["points"])
+	}
+	// The first point, at 500000 tenths, takes three bytes a coordinate.
+	if want := 3*2 + 100*2; len(packed) != want {
+		t.Fatalf("packed %d bytes, want %d", len(packed), want)
+	}
+}
+
+func TestStrokePointsLeftAloneUnlessWellFormed(t *testing.T) {
+	for name, points := range map[string]interface{}{
+		"not an array":   "abc",
+		"not pairs":      []interface{}{[]interface{}{1.0}},
+		"not numbers":    []interface{}{[]interface{}{"1", "2"}},
+		"mixed elements": []interface{}{[]interface{}{1.0, 2.0}, 3.0},
+	} {
+		data := map[string]interface{}{"points": points}
+		packStrokePoints(data)
+		if _, packed := data["points"].([]byte); packed {
+			t.Errorf("%s: packed", name)
+		}
+	}
+}
+
+func TestDecodeRejectsMalformedPoints(t *testing.T) {
+	for name, points := range map[string][]byte{
+		"truncated varint": {0x80},
+		"missing y":        {0x02},
+	} {
+		payload, err := msgpack.Marshal(&wireMessage{Type: TypeStroke, Data: map[string]interface{}{"points": points}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := (msgpackCodec{}).Decode(payload); !errors.Is(err, errBadPoints) {
+			t.Errorf("%s: got %v, want errBadPoints", name, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Recipients addresses a message to specific connections or users. Each
+// entry is either a connection ID or a user ID; a user ID reaches every
+// connection of that user. On the wire it may be a single string or a list.
+type Recipients []string
+
+func (r *Recipients) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*r = nil
+		return nil
+	}
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*r = Recipients{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("to must be a string or a list of strings: %w", err)
+	}
+	*r = many
+	return nil
+}
+
+func (r *Recipients) DecodeMsgpack(dec *msgpack.Decoder) error {
+	value, err := dec.DecodeInterface()
+	if err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+	case string:
+		*r = Recipients{v}
+	case []interface{}:
+		many := make(Recipients, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("to must be a string or a list of strings")
+			}
+			many = append(many, s)
+		}
+		*r = many
+	default:
+		return fmt.Errorf("to must be a string or a list of strings")
+	}
+	return nil
+}
+
+// matches reports whether the client is one of the recipients.
+func (r Recipients) matches(client *Client) bool {
+	for _, id := range r {
+		if id == client.id || id == client.userID {
+			return true
+		}
+	}
+	return false
+}
+
+// route says who a client message is for. From is always the sender's
+// connection ID, which doubles as its WebRTC peer ID.
+type route struct {
+	From string     `json:"from,omitempty"`
+	To   Recipients `json:"to,omitempty"`
+	// P2P marks a message the sender already delivered over its data
+	// channels; the server relays it only to peers without one.
+	P2P bool `json:"p2p,omitempty"`
+	// SkipSender leaves the sender out of a broadcast, e.g. because it
+	// gets an ack instead.
+	SkipSender bool `json:"skip_sender,omitempty"`
+}
+
+// sendDirect delivers an addressed message to the matching local clients.
+// The sender's own room also checks presence across all instances and
+// answers with an error frame naming the recipients that are not connected.
+func (r *room) sendDirect(message []byte, messageType string, rt route, local bool) {
+	for client := range r.clients {
+		if rt.To.matches(client) {
+			r.sendTo(client, message, messageType)
+		}
+	}
+	if !local {
+		return
+	}
+
+	sender, ok := r.byID[rt.From]
+	if !ok {
+		return
+	}
+	var missing []string
+	for _, id := range rt.To {
+		if !r.isPresent(id) {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	notice, err := systemMessage("error", r.artboardID, sender.userID, map[string]interface{}{
+		"code":         "not_connected",
+		"message_type": messageType,
+		"targets":      missing,
+	})
+	if err != nil {
+		log.Printf("Error marshaling error frame: %v", err)
+		return
+	}
+	r.sendTo(sender, notice, "error")
+}
+
+// isPresent reports whether a connection or user ID is in the room on any
+// instance.
+func (r *room) isPresent(id string) bool {
+	if _, ok := r.peers[id]; ok {
+		return true
+	}
+	for _, peer := range r.peers {
+		if peer.UserID == id {
+			return true
+		}
+	}
+	return false
+}
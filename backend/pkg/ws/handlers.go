@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"goP2Pbackend/internal/domain"
+)
+
+// A Handler serves a message type the hub does not know itself, such as
+// chat. It gets the message already stamped with the sender's user,
+// artboard and connection, runs on the sender's read goroutine, and sends
+// whatever the room should see with Hub.Broadcast. A successful message
+// with an op_id is acked; an error is nacked with NackRejected, or with
+// NackForbidden if it is domain.ErrForbidden.
+type Handler func(msg *Message) error
+
+// Handle registers handler for a message type. It must be called before the
+// hub starts serving connections.
+func (h *Hub) Handle(messageType string, handler Handler) {
+	h.handlers[messageType] = handler
+}
+
+// Broadcast sends a server-built message to everyone in the room for
+// msg.ArtboardID, on every instance.
+func (h *Hub) Broadcast(msg *Message) error {
+	message, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", msg.Type, err)
+	}
+
+	h.mutex.Lock()
+	r, ok := h.rooms[msg.ArtboardID]
+	h.mutex.Unlock()
+	if ok {
+		r.post(roomEvent{message: message, messageType: msg.Type})
+	}
+	h.publish(msg.ArtboardID, envelope{Kind: kindMessage, Type: msg.Type, Message: message})
+	return nil
+}
+
+// handle runs the registered handler for msg and reports the outcome to
+// the sender.
+func (c *Client) handle(handler Handler, msg *Message) {
+	if err := handler(msg); err != nil {
+		log.Printf("Error handling %s: %v", msg.Type, err)
+		reason := NackRejected
+		if errors.Is(err, domain.ErrForbidden) {
+			reason = NackForbidden
+		}
+		c.nack(msg.OpID, reason)
+		return
+	}
+	if msg.OpID == "" {
+		return
+	}
+	ack, err := systemMessage("ack", c.artboardID, c.userID, opResult{OpID: msg.OpID})
+	if err != nil {
+		log.Printf("Error marshaling ack: %v", err)
+		return
+	}
+	c.room.post(roomEvent{target: c, message: ack, messageType: "ack"})
+}
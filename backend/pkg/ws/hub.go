@@ -1,184 +1,313 @@
-package websocket
-
-//his file implements the WebSocket hub for real-time collaboration.
-//It manages WebSocket connections, rooms (based on artboard IDs), and message broadcasting.
-// It includes functionality to:
-// 1) Register and unregister clients
-// 2) Broadcast messages to all clients in a specific artboard room
-// 3) Handle WebSocket upgrades
-// 4) Implement read and write pumps for each client
-
-import (
-	"encoding/json"
-	"log"
-	"net/http"
-	"sync"
-
-	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
-)
-
-type Client struct {
-	hub        *Hub
-	conn       *websocket.Conn
-	send       chan []byte
-	artboardID string
-	userID     string
-}
-
-type Hub struct {
-	clients    map[*Client]bool
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan []byte
-	rooms      map[string]map[*Client]bool
-	mutex      sync.Mutex
-}
-
-type Message struct {
-	Type       string          `json:"type"`
-	ArtboardID string          `json:"artboard_id"`
-	UserID     string          `json:"user_id"`
-	Data       json.RawMessage `json:"data"`
-}
-
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Adjust this for production!
-	},
-}
-
-func NewHub() *Hub {
-	return &Hub{
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
-		rooms:      make(map[string]map[*Client]bool),
-	}
-}
-
-func (h *Hub) Run() {
-	for {
-		select {
-		case client := <-h.register:
-			h.mutex.Lock()
-			if _, ok := h.rooms[client.artboardID]; !ok {
-				h.rooms[client.artboardID] = make(map[*Client]bool)
-			}
-			h.rooms[client.artboardID][client] = true
-			h.mutex.Unlock()
-		case client := <-h.unregister:
-			h.mutex.Lock()
-			if _, ok := h.rooms[client.artboardID]; ok {
-				delete(h.rooms[client.artboardID], client)
-				close(client.send)
-				if len(h.rooms[client.artboardID]) == 0 {
-					delete(h.rooms, client.artboardID)
-				}
-			}
-			h.mutex.Unlock()
-		case message := <-h.broadcast:
-			var msg Message
-			if err := json.Unmarshal(message, &msg); err != nil {
-				log.Printf("Error unmarshaling message: %v", err)
-				continue
-			}
-			h.mutex.Lock()
-			if clients, ok := h.rooms[msg.ArtboardID]; ok {
-				for client := range clients {
-					select {
-					case client.send <- message:
-					default:
-						close(client.send)
-						delete(clients, client)
-						if len(clients) == 0 {
-							delete(h.rooms, msg.ArtboardID)
-						}
-					}
-				}
-			}
-			h.mutex.Unlock()
-		}
-	}
-}
-
-func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	vars := mux.Vars(r)
-	artboardID := vars["artboardID"]
-	userID := r.URL.Query().Get("user_id") // Assume user_id is passed as a query parameter
-
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256), artboardID: artboardID, userID: userID}
-	client.hub.register <- client
-
-	go client.writePump()
-	go client.readPump()
-}
-
-func (c *Client) readPump() {
-	defer func() {
-		c.hub.unregister <- c
-		c.conn.Close()
-	}()
-
-	for {
-		_, message, err := c.conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
-			}
-			break
-		}
-
-		var msg Message
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Printf("Error unmarshaling message: %v", err)
-			continue
-		}
-
-		msg.UserID = c.userID
-		msg.ArtboardID = c.artboardID
-
-		updatedMessage, err := json.Marshal(msg)
-		if err != nil {
-			log.Printf("Error marshaling message: %v", err)
-			continue
-		}
-
-		c.hub.broadcast <- updatedMessage
-	}
-}
-
-func (c *Client) writePump() {
-	defer func() {
-		c.conn.Close()
-	}()
-
-	for {
-		select {
-		case message, ok := <-c.send:
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			if err := w.Close(); err != nil {
-				return
-			}
-		}
-	}
-}
+package websocket
+
+// This file implements the WebSocket hub for real-time collaboration.
+// It manages WebSocket connections, rooms (based on artboard IDs), and message broadcasting.
+// It includes functionality to:
+// 1) Register and unregister clients
+// 2) Broadcast messages to all clients in a specific artboard room
+//    (each room is an actor with its own goroutine and inbox, see room.go)
+// 3) Share rooms, presence and sequence numbers across instances through a Broker
+// 4) Handle WebSocket upgrades, negotiating JSON or MessagePack framing (see codec.go)
+// 5) Implement read and write pumps for each client
+// 6) Deliver messages addressed to specific connections or users (see direct.go)
+// 7) Relay WebRTC signaling between peers in a room (see signaling.go)
+// 8) Sequence, log and undo/redo board operations (see ops.go)
+// 9) Lock objects for exclusive edits (see locks.go)
+// 10) Hand other message types, like chat, to registered handlers (see handlers.go)
+// 11) Push events to all connections of a user and enforce edit permissions (see users.go)
+// 12) Checkpoint boards and apply server-side operations (see checkpoints.go)
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// Config holds the connection tunables used by the hub.
+type Config struct {
+	// Time allowed to write a message to the peer.
+	WriteWait time.Duration
+	// Time allowed to read the next pong message from the peer.
+	PongWait time.Duration
+	// Send pings to peer with this period. Must be less than PongWait.
+	PingPeriod time.Duration
+	// Maximum message size allowed from peer.
+	MaxMessageSize int64
+	// I/O buffer sizes handed to the upgrader.
+	ReadBufferSize  int
+	WriteBufferSize int
+	// Number of outbound messages queued per client.
+	SendBufferSize int
+	// Number of pending events queued per room.
+	RoomBufferSize int
+	// Number of ephemeral messages a slow client may miss in a row
+	// before it is disconnected.
+	MaxDroppedMessages int
+	// Negotiate permessage-deflate, compressing at CompressionLevel
+	// (see compress/flate).
+	EnableCompression bool
+	CompressionLevel  int
+	// Queued messages are coalesced into one frame until either limit is
+	// reached. A BatchMaxMessages of 1 sends every message on its own.
+	BatchMaxMessages int
+	BatchMaxBytes    int
+	// Per-client limits keyed by rate class (RateClassCursor, RateClassOps,
+	// RateClassChat), and one limit shared by everyone in a room.
+	RateLimits    map[string]RateLimit
+	RoomRateLimit RateLimit
+	// Rejected messages tolerated within a minute before the client is
+	// disconnected with a policy-violation close code.
+	MaxRateViolations int
+	// STUN/TURN URLs handed to clients for WebRTC sessions.
+	ICEServers []string
+	// Operations each user can undo.
+	MaxUndoDepth int
+	// How long an object lock lasts unless renewed.
+	LockTimeout time.Duration
+	// A room checkpoints after this many local operations, or after
+	// CheckpointInterval if there were any (see checkpoints.go).
+	CheckpointEvery    int
+	CheckpointInterval time.Duration
+}
+
+// DefaultConfig returns the settings used when none are configured.
+func DefaultConfig() Config {
+	return Config{
+		WriteWait:          10 * time.Second,
+		PongWait:           60 * time.Second,
+		PingPeriod:         54 * time.Second,
+		MaxMessageSize:     64 * 1024,
+		ReadBufferSize:     1024,
+		WriteBufferSize:    1024,
+		SendBufferSize:     256,
+		RoomBufferSize:     256,
+		MaxDroppedMessages: 32,
+		EnableCompression:  false,
+		CompressionLevel:   1,
+		BatchMaxMessages:   1,
+		BatchMaxBytes:      32 * 1024,
+		RateLimits: map[string]RateLimit{
+			RateClassCursor: {Rate: 60, Burst: 120},
+			RateClassOps:    {Rate: 30, Burst: 60},
+			RateClassChat:   {Rate: 2, Burst: 5},
+		},
+		RoomRateLimit:      RateLimit{Rate: 500, Burst: 1000},
+		MaxRateViolations:  20,
+		ICEServers:         []string{"stun:stun.l.google.com:19302"},
+		MaxUndoDepth:       100,
+		LockTimeout:        30 * time.Second,
+		CheckpointEvery:    200,
+		CheckpointInterval: 10 * time.Minute,
+	}
+}
+
+type Hub struct {
+	rooms      map[string]*room
+	mutex      sync.Mutex
+	config     Config
+	upgrader   websocket.Upgrader
+	metrics    *Metrics
+	broker     Broker
+	operations domain.OperationRepository
+	handlers   map[string]Handler
+	editPolicy EditPolicy
+	// Save automatic versions and load the latest; optional.
+	checkpointer     Checkpointer
+	checkpointLoader CheckpointLoader
+	// Broker subscriptions of the users connected here; guarded by mutex.
+	users      map[string]*userSubscription
+	instanceID string
+}
+
+type Message struct {
+	Type       string          `json:"type"`
+	ArtboardID string          `json:"artboard_id"`
+	UserID     string          `json:"user_id"`
+	From       string          `json:"from,omitempty"`
+	To         Recipients      `json:"to,omitempty"`
+	P2P        bool            `json:"p2p,omitempty"`
+	OpID       string          `json:"op_id,omitempty"`
+	Seq        int64           `json:"seq,omitempty"`
+	UndoOf     int64           `json:"undo_of,omitempty"`
+	RedoOf     int64           `json:"redo_of,omitempty"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// systemMessage builds a message generated by the server itself.
+func systemMessage(messageType, artboardID, userID string, data interface{}) ([]byte, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Message{Type: messageType, ArtboardID: artboardID, UserID: userID, Data: raw})
+}
+
+// NewHub creates a hub. operations may be nil, in which case the operation
+// log is only kept in memory while a room is open.
+func NewHub(config Config, broker Broker, operations domain.OperationRepository) *Hub {
+	return &Hub{
+		rooms:      make(map[string]*room),
+		config:     config,
+		broker:     broker,
+		operations: operations,
+		handlers:   make(map[string]Handler),
+		users:      make(map[string]*userSubscription),
+		instanceID: uuid.New().String(),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:    config.ReadBufferSize,
+			WriteBufferSize:   config.WriteBufferSize,
+			Subprotocols:      []string{SubprotocolMsgpack, SubprotocolJSON},
+			EnableCompression: config.EnableCompression,
+			CheckOrigin: func(r *http.Request) bool {
+				return true // Adjust this for production!
+			},
+		},
+		metrics: newMetrics(),
+	}
+}
+
+// Metrics returns the hub's connection metrics.
+func (h *Hub) Metrics() *Metrics {
+	return h.metrics
+}
+
+// acquire returns the room for artboardID, starting it if nobody holds it
+// yet, and keeps it running until release. The hub lock only guards the
+// room table; message traffic never takes it.
+func (h *Hub) acquire(artboardID string) (*room, error) {
+	h.mutex.Lock()
+	r, ok := h.rooms[artboardID]
+	if !ok {
+		r = newRoom(h, artboardID)
+		unsubscribe, err := h.broker.Subscribe(artboardID, r.deliver)
+		if err != nil {
+			h.mutex.Unlock()
+			return nil, fmt.Errorf("failed to subscribe to room %s: %w", artboardID, err)
+		}
+		r.unsubscribe = unsubscribe
+		h.rooms[artboardID] = r
+		go r.run()
+	}
+	r.members++
+	h.mutex.Unlock()
+
+	if !ok {
+		// Ask the other instances who is already in the room.
+		h.publish(artboardID, envelope{Kind: kindSyncRequest})
+	}
+	return r, nil
+}
+
+// release lets go of a room and stops it once nobody holds it.
+func (h *Hub) release(r *room) {
+	h.mutex.Lock()
+	r.members--
+	stopped := r.members == 0
+	if stopped {
+		delete(h.rooms, r.artboardID)
+		close(r.done)
+	}
+	h.mutex.Unlock()
+
+	if stopped {
+		r.unsubscribe()
+	}
+}
+
+// join adds client to the room for its artboard.
+func (h *Hub) join(client *Client) error {
+	r, err := h.acquire(client.artboardID)
+	if err != nil {
+		return err
+	}
+	client.room = r
+	r.post(roomEvent{register: client})
+	h.publish(client.artboardID, envelope{Kind: kindJoin, Peers: []Peer{client.peer()}})
+	return nil
+}
+
+// leave removes client from its room and stops the room once it is empty.
+func (h *Hub) leave(client *Client) {
+	r := client.room
+	r.post(roomEvent{unregister: client})
+	h.publish(client.artboardID, envelope{Kind: kindLeave, Peers: []Peer{client.peer()}})
+	h.release(r)
+
+	if client.userID != "" {
+		h.unsubscribeUser(client.userID)
+	}
+}
+
+// publish hands an envelope to the broker for the other instances.
+func (h *Hub) publish(artboardID string, env envelope) {
+	env.Origin = h.instanceID
+	payload, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("Error marshaling envelope: %v", err)
+		return
+	}
+	if err := h.broker.Publish(artboardID, payload); err != nil {
+		log.Printf("Error publishing to room %s: %v", artboardID, err)
+	}
+}
+
+// ServeWs upgrades an authenticated request to a connection on the
+// artboard's room. userID must be the identity the request authenticated
+// as; anonymous connections are refused, and so are users the edit policy
+// denies all access.
+func ServeWs(hub *Hub, userID string, w http.ResponseWriter, r *http.Request) {
+	if userID == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	artboardID := vars["artboardID"]
+	canEdit, err := hub.canEdit(artboardID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrForbidden):
+			http.Error(w, "forbidden", http.StatusForbidden)
+		case errors.Is(err, domain.ErrNotFound):
+			http.Error(w, "not found", http.StatusNotFound)
+		default:
+			log.Printf("Error checking access of %s to %s: %v", userID, artboardID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	conn, err := hub.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if hub.config.EnableCompression {
+		if err := conn.SetCompressionLevel(hub.config.CompressionLevel); err != nil {
+			log.Println(err)
+		}
+	}
+
+	client := &Client{hub: hub, conn: conn, send: make(chan *frame, hub.config.SendBufferSize), codec: codecFor(conn.Subprotocol()), limiter: newClientLimiter(hub.config.RateLimits), id: uuid.New().String(), artboardID: artboardID, userID: userID}
+	client.canEdit = canEdit
+	if err := hub.join(client); err != nil {
+		log.Println(err)
+		conn.Close()
+		return
+	}
+	hub.subscribeUser(userID)
+
+	go client.writePump()
+	go client.readPump()
+}
@@ -0,0 +1,319 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer serves hub's WebSocket endpoint, taking the user from the
+// "user" query parameter in place of the auth middleware.
+func newTestServer(t testing.TB, hub *Hub) *httptest.Server {
+	router := mux.NewRouter()
+	router.HandleFunc("/ws/{artboardID}", func(w http.ResponseWriter, r *http.Request) {
+		ServeWs(hub, r.URL.Query().Get("user"), w, r)
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func wsURL(server *httptest.Server, artboardID, userID string) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/" + artboardID + "?user=" + userID
+}
+
+func dial(t testing.TB, server *httptest.Server, artboardID, userID string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(server, artboardID, userID), nil)
+	if err != nil {
+		t.Fatalf("dial %s as %s: %v", artboardID, userID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readType reads messages until one of type messageType arrives.
+func readType(t testing.TB, conn *websocket.Conn, messageType string) *Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", messageType, err)
+		}
+		for _, line := range bytes.Split(payload, newline) {
+			var msg Message
+			if err := json.Unmarshal(line, &msg); err != nil {
+				t.Fatalf("decoding %q: %v", line, err)
+			}
+			if msg.Type == messageType {
+				return &msg
+			}
+		}
+	}
+}
+
+// readPeers waits for a presence message listing count peers.
+func readPeers(t testing.TB, conn *websocket.Conn, count int) {
+	t.Helper()
+	for {
+		msg := readType(t, conn, "presence")
+		var presence struct {
+			Peers []Peer `json:"peers"`
+		}
+		if err := json.Unmarshal(msg.Data, &presence); err != nil {
+			t.Fatal(err)
+		}
+		if len(presence.Peers) == count {
+			return
+		}
+	}
+}
+
+// waitFor polls cond until it holds or a few seconds have passed.
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func roomCount(hub *Hub) int {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	return len(hub.rooms)
+}
+
+func TestJoinAndLeaveStopRoom(t *testing.T) {
+	hub := NewHub(DefaultConfig(), NewMemoryBroker(), nil)
+	server := newTestServer(t, hub)
+
+	alice := dial(t, server, "board", "alice")
+	readType(t, alice, "welcome")
+	readType(t, alice, "sync")
+	readPeers(t, alice, 1)
+
+	bob := dial(t, server, "board", "bob")
+	readType(t, bob, "welcome")
+	readPeers(t, alice, 2)
+	if n := roomCount(hub); n != 1 {
+		t.Fatalf("rooms = %d, want 1", n)
+	}
+
+	bob.Close()
+	readPeers(t, alice, 1)
+	waitFor(t, "bob to go offline", func() bool { return !hub.IsOnline("bob") })
+	if !hub.IsOnline("alice") {
+		t.Fatal("alice went offline with bob")
+	}
+
+	alice.Close()
+	waitFor(t, "the room to stop", func() bool { return roomCount(hub) == 0 })
+	waitFor(t, "alice to go offline", func() bool { return !hub.IsOnline("alice") })
+}
+
+func TestMessagesReachTheRoomStamped(t *testing.T) {
+	hub := NewHub(DefaultConfig(), NewMemoryBroker(), nil)
+	server := newTestServer(t, hub)
+
+	alice := dial(t, server, "board", "alice")
+	readType(t, alice, "welcome")
+	bob := dial(t, server, "board", "bob")
+	readType(t, bob, "welcome")
+	readPeers(t, bob, 2)
+
+	err := alice.WriteJSON(Message{Type: "cursor", UserID: "mallory", ArtboardID: "other", Data: json.RawMessage(`{"x":1}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := readType(t, bob, "cursor")
+	if msg.UserID != "alice" || msg.ArtboardID != "board" {
+		t.Fatalf("cursor from %q on %q, want alice on board", msg.UserID, msg.ArtboardID)
+	}
+}
+
+func TestRoomsAreSeparate(t *testing.T) {
+	hub := NewHub(DefaultConfig(), NewMemoryBroker(), nil)
+	server := newTestServer(t, hub)
+
+	alice := dial(t, server, "one", "alice")
+	readPeers(t, alice, 1)
+	bob := dial(t, server, "two", "bob")
+	readPeers(t, bob, 1)
+	if n := roomCount(hub); n != 2 {
+		t.Fatalf("rooms = %d, want 2", n)
+	}
+
+	if err := alice.WriteJSON(Message{Type: "cursor", Data: json.RawMessage(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	bob.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, payload, err := bob.ReadMessage(); err == nil {
+		t.Fatalf("bob received %s from another room", payload)
+	}
+}
+
+func TestConcurrentJoinAndLeave(t *testing.T) {
+	hub := NewHub(DefaultConfig(), NewMemoryBroker(), nil)
+	server := newTestServer(t, hub)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				conn, _, err := websocket.DefaultDialer.Dial(wsURL(server, fmt.Sprintf("board-%d", (i+j)%3), fmt.Sprintf("user-%d", i%4)), nil)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				conn.WriteJSON(Message{Type: "cursor", Data: json.RawMessage(`{}`)})
+				conn.Close()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	waitFor(t, "every room to stop", func() bool { return roomCount(hub) == 0 })
+	for i := 0; i < 4; i++ {
+		if userID := fmt.Sprintf("user-%d", i); hub.IsOnline(userID) {
+			t.Errorf("%s is still online", userID)
+		}
+	}
+}
+
+func TestPostToStoppedRoomReturns(t *testing.T) {
+	hub := NewHub(DefaultConfig(), NewMemoryBroker(), nil)
+	r, err := hub.acquire("board")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.release(r)
+
+	posted := make(chan struct{})
+	go func() {
+		for i := 0; i < hub.config.RoomBufferSize+1; i++ {
+			r.post(roomEvent{message: []byte(`{}`), messageType: "cursor"})
+		}
+		close(posted)
+	}()
+	select {
+	case <-posted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("post blocked on a stopped room")
+	}
+}
+
+func TestServeWsRefusesConnections(t *testing.T) {
+	hub := NewHub(DefaultConfig(), NewMemoryBroker(), nil)
+	hub.SetEditPolicy(func(artboardID, userID string) (bool, error) {
+		if userID == "stranger" {
+			return false, domain.ErrForbidden
+		}
+		return true, nil
+	})
+	server := newTestServer(t, hub)
+
+	for userID, status := range map[string]int{"": http.StatusUnauthorized, "stranger": http.StatusForbidden} {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL(server, "board", userID), nil)
+		if err == nil {
+			t.Fatalf("%q connected", userID)
+		}
+		if resp == nil || resp.StatusCode != status {
+			t.Fatalf("%q got %v, want status %d", userID, resp, status)
+		}
+	}
+	if n := roomCount(hub); n != 0 {
+		t.Fatalf("rooms = %d after refused connections, want 0", n)
+	}
+}
+
+func TestBroadcastSlowConsumerPolicy(t *testing.T) {
+	const maxDropped = 3
+	for _, tc := range []struct {
+		name        string
+		messageType string
+		// How many broadcasts the full client survives.
+		survives int
+	}{
+		{"ephemeral", "cursor", maxDropped},
+		{"not ephemeral", "chat", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.MaxDroppedMessages = maxDropped
+			hub := NewHub(config, NewMemoryBroker(), nil)
+			r := newRoom(hub, "board")
+			slow := &Client{hub: hub, room: r, send: make(chan *frame, 1), codec: jsonCodec{}, id: "slow", artboardID: "board"}
+			r.clients[slow] = true
+			r.byID[slow.id] = slow
+			message := []byte(`{"type":"` + tc.messageType + `"}`)
+
+			// Fill the buffer; the client never reads.
+			r.broadcast(message, tc.messageType, route{})
+			for i := 0; i < tc.survives; i++ {
+				r.broadcast(message, tc.messageType, route{})
+				if !r.clients[slow] {
+					t.Fatalf("disconnected after dropping %d messages, want %d allowed", i, tc.survives)
+				}
+			}
+			if dropped := hub.metrics.DroppedMessages(); dropped != uint64(tc.survives) {
+				t.Fatalf("dropped %d messages, want %d", dropped, tc.survives)
+			}
+
+			r.broadcast(message, tc.messageType, route{})
+			if r.clients[slow] {
+				t.Fatal("still connected after falling too far behind")
+			}
+			if slow.closeCode != websocket.CloseTryAgainLater {
+				t.Fatalf("close code %d, want CloseTryAgainLater", slow.closeCode)
+			}
+			if n := hub.metrics.ClosedConnections()[CloseReasonSlowConsumer]; n != 1 {
+				t.Fatalf("%d slow-consumer closes recorded, want 1", n)
+			}
+			// What was queued before is still written, then send is closed.
+			<-slow.send
+			if _, open := <-slow.send; open {
+				t.Fatal("send is still open")
+			}
+		})
+	}
+}
+
+func TestBroadcastForgivesClientsThatCatchUp(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxDroppedMessages = 2
+	hub := NewHub(config, NewMemoryBroker(), nil)
+	r := newRoom(hub, "board")
+	client := &Client{hub: hub, room: r, send: make(chan *frame, 1), codec: jsonCodec{}, id: "client", artboardID: "board"}
+	r.clients[client] = true
+	r.byID[client.id] = client
+	message := []byte(`{"type":"cursor"}`)
+
+	// Each round drops as many as allowed, then a delivery resets the count.
+	for round := 0; round < 3; round++ {
+		for i := 0; i <= config.MaxDroppedMessages; i++ {
+			r.broadcast(message, "cursor", route{})
+		}
+		if !r.clients[client] {
+			t.Fatalf("disconnected in round %d", round)
+		}
+		<-client.send
+	}
+}
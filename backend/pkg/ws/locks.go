@@ -0,0 +1,197 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"goP2Pbackend/pkg/board"
+)
+
+// Lock message types. A client locks an object before dragging it or
+// editing its text, and keeps the lock by sending lock again before it
+// expires. The room answers by broadcasting lock/unlock to everyone, the
+// requester included; a request for an object someone else holds gets a
+// nack. Locks are released on unlock, on disconnect, when they expire and
+// when the object is deleted.
+const (
+	TypeLock   = "lock"
+	TypeUnlock = "unlock"
+)
+
+var lockTypes = map[string]bool{
+	TypeLock:   true,
+	TypeUnlock: true,
+}
+
+type objectLock struct {
+	ObjectID     string    `json:"id"`
+	ConnectionID string    `json:"connection_id"`
+	UserID       string    `json:"user_id"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// wins settles two instances granting the same object at once: both keep
+// the lock of the smaller connection ID.
+func (l *objectLock) wins(other *objectLock) bool {
+	return l.ConnectionID < other.ConnectionID
+}
+
+// submit hands a stamped request to the room without publishing it; the
+// room decides what the other instances get to see.
+func (c *Client) submit(msg *Message) {
+	message, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+	c.room.post(roomEvent{message: message, messageType: msg.Type, route: route{From: c.id}})
+}
+
+// lockRequest serves a lock or unlock request from a local client.
+func (r *room) lockRequest(message []byte, messageType string, rt route) {
+	sender, ok := r.byID[rt.From]
+	if !ok {
+		return
+	}
+	var msg Message
+	if err := json.Unmarshal(message, &msg); err != nil {
+		log.Printf("Error unmarshaling %s: %v", messageType, err)
+		return
+	}
+	objectID, err := board.ObjectID(msg.Data)
+	if err != nil {
+		r.reject(rt.From, msg.OpID, NackInvalidOperation)
+		return
+	}
+	if r.lockedByOther(objectID, sender.id) {
+		r.reject(rt.From, msg.OpID, NackLocked)
+		return
+	}
+
+	if messageType == TypeUnlock {
+		if _, held := r.locks[objectID]; held {
+			r.unlock(objectID, true)
+		}
+		return
+	}
+	r.lock(&objectLock{
+		ObjectID:     objectID,
+		ConnectionID: sender.id,
+		UserID:       sender.userID,
+		ExpiresAt:    time.Now().Add(r.hub.config.LockTimeout),
+	}, true)
+}
+
+// lockedByOther reports whether someone other than connectionID holds a
+// live lock on the object.
+func (r *room) lockedByOther(objectID, connectionID string) bool {
+	l, ok := r.locks[objectID]
+	return ok && l.ConnectionID != connectionID && time.Now().Before(l.ExpiresAt)
+}
+
+// lock records l and tells the local clients. local is set for locks granted
+// by this instance, which are also published to the others.
+func (r *room) lock(l *objectLock, local bool) {
+	r.locks[l.ObjectID] = l
+	message, err := r.lockMessage(TypeLock, l)
+	if err != nil {
+		log.Printf("Error marshaling lock: %v", err)
+		return
+	}
+	r.broadcast(message, TypeLock, route{})
+	if local {
+		r.relay(envelope{Kind: kindMessage, Type: TypeLock, Message: message})
+	}
+}
+
+// unlock releases the lock on an object. Only an explicit unlock needs
+// publishing: every instance sees disconnects, expiries and deletes itself.
+func (r *room) unlock(objectID string, local bool) {
+	l, ok := r.locks[objectID]
+	if !ok {
+		return
+	}
+	delete(r.locks, objectID)
+	message, err := r.lockMessage(TypeUnlock, l)
+	if err != nil {
+		log.Printf("Error marshaling unlock: %v", err)
+		return
+	}
+	r.broadcast(message, TypeUnlock, route{})
+	if local {
+		r.relay(envelope{Kind: kindMessage, Type: TypeUnlock, Message: message})
+	}
+}
+
+func (r *room) lockMessage(messageType string, l *objectLock) ([]byte, error) {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Message{Type: messageType, ArtboardID: r.artboardID, UserID: l.UserID, From: l.ConnectionID, Data: data})
+}
+
+// remoteLock applies a lock or unlock published by another instance.
+func (r *room) remoteLock(message []byte, messageType string) {
+	var msg Message
+	if err := json.Unmarshal(message, &msg); err != nil {
+		log.Printf("Error unmarshaling %s: %v", messageType, err)
+		return
+	}
+	var l objectLock
+	if err := json.Unmarshal(msg.Data, &l); err != nil {
+		log.Printf("Error unmarshaling %s: %v", messageType, err)
+		return
+	}
+
+	if messageType == TypeUnlock {
+		if held, ok := r.locks[l.ObjectID]; ok && held.ConnectionID == l.ConnectionID {
+			r.unlock(l.ObjectID, false)
+		}
+		return
+	}
+	r.acceptLock(&l)
+}
+
+// acceptLock takes over a lock granted elsewhere unless a different live
+// lock on the same object beats it.
+func (r *room) acceptLock(l *objectLock) {
+	if r.lockedByOther(l.ObjectID, l.ConnectionID) && !l.wins(r.locks[l.ObjectID]) {
+		return
+	}
+	r.lock(l, false)
+}
+
+// releaseLocks drops every lock held by a connection that went away.
+func (r *room) releaseLocks(connectionID string) {
+	for objectID, l := range r.locks {
+		if l.ConnectionID == connectionID {
+			r.unlock(objectID, false)
+		}
+	}
+}
+
+func (r *room) expireLocks(now time.Time) {
+	for objectID, l := range r.locks {
+		if !now.Before(l.ExpiresAt) {
+			r.unlock(objectID, false)
+		}
+	}
+}
+
+// heldLocks lists the live locks, optionally only those of local clients.
+func (r *room) heldLocks(localOnly bool) []*objectLock {
+	now := time.Now()
+	locks := make([]*objectLock, 0, len(r.locks))
+	for _, l := range r.locks {
+		if !now.Before(l.ExpiresAt) {
+			continue
+		}
+		if _, ok := r.byID[l.ConnectionID]; localOnly && !ok {
+			continue
+		}
+		locks = append(locks, l)
+	}
+	return locks
+}
@@ -0,0 +1,87 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Reasons recorded when a connection is closed.
+const (
+	CloseReasonClientClosed = "client_closed"
+	CloseReasonPongTimeout  = "pong_timeout"
+	CloseReasonTooLarge     = "message_too_large"
+	CloseReasonReadError    = "read_error"
+	CloseReasonWriteTimeout = "write_timeout"
+	CloseReasonWriteError   = "write_error"
+	CloseReasonSlowConsumer = "slow_consumer"
+	CloseReasonRateLimited  = "rate_limited"
+)
+
+// Metrics counts connections closed for each reason, messages dropped for
+// slow consumers and messages rejected by rate limits.
+type Metrics struct {
+	mutex   sync.Mutex
+	closed  map[string]uint64
+	dropped uint64
+	limited uint64
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{closed: make(map[string]uint64)}
+}
+
+func (m *Metrics) connectionClosed(reason string) {
+	m.mutex.Lock()
+	m.closed[reason]++
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) messageDropped() {
+	m.mutex.Lock()
+	m.dropped++
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) rateLimited() {
+	m.mutex.Lock()
+	m.limited++
+	m.mutex.Unlock()
+}
+
+// RateLimitedMessages returns the number of messages rejected by rate limits.
+func (m *Metrics) RateLimitedMessages() uint64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.limited
+}
+
+// DroppedMessages returns the number of ephemeral messages not delivered
+// to slow clients.
+func (m *Metrics) DroppedMessages() uint64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.dropped
+}
+
+// ClosedConnections returns a copy of the close counters keyed by reason.
+func (m *Metrics) ClosedConnections() map[string]uint64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	counts := make(map[string]uint64, len(m.closed))
+	for reason, n := range m.closed {
+		counts[reason] = n
+	}
+	return counts
+}
+
+// ServeMetrics writes the hub metrics as JSON.
+func ServeMetrics(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"closed_connections": hub.metrics.ClosedConnections(),
+		"dropped_messages":   hub.metrics.DroppedMessages(),
+		"rate_limited":       hub.metrics.RateLimitedMessages(),
+	})
+}
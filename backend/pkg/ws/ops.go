@@ -0,0 +1,437 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/board"
+)
+
+// Mutation message types change the board. Each must carry a
+// client-generated op_id; the server assigns it the next sequence number,
+// relays it to everyone else and answers the sender with an ack (or a nack
+// with a reason) so optimistic UI can reconcile.
+const (
+	TypeStroke = board.OpStroke
+	TypeAdd    = board.OpAdd
+	TypeUpdate = board.OpUpdate
+	TypeDelete = board.OpDelete
+)
+
+// Undo and redo revert or re-apply the requesting user's own operations.
+// The server computes the resulting mutation from the operation log and
+// relays it to everyone, the requester included, as a regular operation.
+const (
+	TypeUndo = "undo"
+	TypeRedo = "redo"
+)
+
+var mutationTypes = map[string]bool{
+	TypeStroke: true,
+	TypeAdd:    true,
+	TypeUpdate: true,
+	TypeDelete: true,
+}
+
+// editTypes are the messages only users allowed to edit may send.
+var editTypes = map[string]bool{
+	TypeStroke: true,
+	TypeAdd:    true,
+	TypeUpdate: true,
+	TypeDelete: true,
+	TypeUndo:   true,
+	TypeRedo:   true,
+	TypeLock:   true,
+	TypeUnlock: true,
+}
+
+// Reasons sent in nack frames.
+const (
+	NackMissingOpID         = "missing_op_id"
+	NackRateLimited         = "rate_limited"
+	NackSequenceUnavailable = "sequence_unavailable"
+	NackInvalidOperation    = "invalid_operation"
+	NackObjectNotFound      = "object_not_found"
+	NackNothingToUndo       = "nothing_to_undo"
+	NackNothingToRedo       = "nothing_to_redo"
+	NackConflict            = "conflict"
+	NackLocked              = "locked"
+	NackRejected            = "rejected"
+	NackForbidden           = "forbidden"
+)
+
+type opResult struct {
+	OpID   string `json:"op_id"`
+	Seq    int64  `json:"seq,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// seqRequest asks a room's sequencer to number an event before the room
+// gets it. A single sequencer per room takes the numbers from the broker in
+// the order requests arrive and posts the events in that same order, so the
+// room applies its local operations strictly by sequence number without
+// ever waiting on the broker itself.
+type seqRequest struct {
+	event roomEvent
+	// count is how many numbers to reserve into event.seqs.
+	count int
+	// msg, if set, gets the first number and is marshaled into
+	// event.message.
+	msg *Message
+}
+
+// sequence queues req for the room's sequencer. Once the room has stopped
+// the request is discarded instead of blocking the caller.
+func (r *room) sequence(req seqRequest) {
+	select {
+	case r.sequencer <- req:
+	case <-r.done:
+	}
+}
+
+// runSequencer numbers the room's local operations, see seqRequest.
+func (r *room) runSequencer() {
+	for {
+		select {
+		case req := <-r.sequencer:
+			r.number(req)
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *room) number(req seqRequest) {
+	event := req.event
+	for i := 0; i < req.count; i++ {
+		seq, err := r.hub.broker.NextSeq(r.artboardID)
+		if err != nil {
+			log.Printf("Error assigning sequence number: %v", err)
+			event.seqErr = err
+			break
+		}
+		event.seqs = append(event.seqs, seq)
+	}
+	if req.msg != nil {
+		if event.seqErr == nil {
+			req.msg.Seq = event.seqs[0]
+		}
+		message, err := json.Marshal(req.msg)
+		if err != nil {
+			log.Printf("Error marshaling message: %v", err)
+			return
+		}
+		event.message = message
+	}
+	r.post(event)
+}
+
+// unsequenced fails an event the sequencer could not number.
+func (r *room) unsequenced(event roomEvent) {
+	if event.patch != nil {
+		event.patch.reply <- patchResult{err: fmt.Errorf("failed to assign sequence number: %w", event.seqErr)}
+		return
+	}
+	var msg Message
+	if err := json.Unmarshal(event.message, &msg); err != nil {
+		log.Printf("Error unmarshaling %s: %v", event.messageType, err)
+		return
+	}
+	r.reject(event.route.From, msg.OpID, NackSequenceUnavailable)
+}
+
+// mutate has a board mutation numbered and handed to the room, which
+// applies it, relays it to everyone else and acknowledges it to the sender.
+func (c *Client) mutate(msg *Message) {
+	if msg.OpID == "" {
+		c.nack(msg.OpID, NackMissingOpID)
+		return
+	}
+	msg.To = nil
+	c.room.sequence(seqRequest{
+		event: roomEvent{messageType: msg.Type, route: route{From: c.id, SkipSender: true}},
+		count: 1,
+		msg:   msg,
+	})
+}
+
+// nack rejects a mutation back to the sender.
+func (c *Client) nack(opID, reason string) {
+	message, err := systemMessage("nack", c.artboardID, c.userID, opResult{OpID: opID, Reason: reason})
+	if err != nil {
+		log.Printf("Error marshaling nack: %v", err)
+		return
+	}
+	c.room.post(roomEvent{target: c, message: message, messageType: "nack"})
+}
+
+// history forwards an undo or redo request to the room, which owns the
+// operation log. The request is numbered on the way, like a mutation, and
+// the number goes to the operation the room computes for it.
+func (c *Client) history(msg *Message) {
+	if msg.OpID == "" {
+		c.nack(msg.OpID, NackMissingOpID)
+		return
+	}
+	c.room.sequence(seqRequest{
+		event: roomEvent{messageType: msg.Type, route: route{From: c.id}},
+		count: 1,
+		msg:   msg,
+	})
+}
+
+// load rebuilds the document from the latest checkpoint and the operations
+// logged since, which are also all the undo stacks start with.
+func (r *room) load() {
+	r.loadCheckpoint()
+	if r.hub.operations == nil {
+		return
+	}
+	ops, err := r.hub.operations.ListByArtboard(r.artboardID, r.seq, 0)
+	if err != nil {
+		log.Printf("Error loading operations for %s: %v", r.artboardID, err)
+		return
+	}
+	for _, op := range ops {
+		if _, err := r.doc.Apply(op.Type, op.Data); err != nil {
+			log.Printf("Error replaying operation %d of %s: %v", op.Seq, r.artboardID, err)
+			continue
+		}
+		r.track(op)
+		r.seq = op.Seq
+	}
+}
+
+// writeOperations appends operations to the log in order, off the room
+// goroutine.
+func (r *room) writeOperations() {
+	for op := range r.oplog {
+		if err := r.hub.operations.Append(op); err != nil {
+			log.Printf("Error appending operation %d of %s: %v", op.Seq, r.artboardID, err)
+		}
+	}
+}
+
+func (r *room) persist(op *domain.Operation) {
+	if r.oplog != nil {
+		r.oplog <- op
+	}
+}
+
+// apply performs a sequenced mutation on the room's document.
+func (r *room) apply(msg *Message) (*domain.Operation, error) {
+	objectID, err := board.ObjectID(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := r.doc.Apply(msg.Type, msg.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	op := &domain.Operation{
+		ArtboardID: r.artboardID,
+		Seq:        msg.Seq,
+		OpID:       msg.OpID,
+		UserID:     msg.UserID,
+		Type:       msg.Type,
+		ObjectID:   objectID,
+		Data:       msg.Data,
+		Prev:       prev,
+		UndoOf:     msg.UndoOf,
+		RedoOf:     msg.RedoOf,
+		CreatedAt:  time.Now(),
+	}
+	r.track(op)
+	if msg.Type == TypeDelete {
+		r.unlock(objectID, false)
+	}
+	if msg.Seq > r.seq {
+		r.seq = msg.Seq
+	}
+	return op, nil
+}
+
+// track keeps each user's undo and redo stacks in step with the log.
+func (r *room) track(op *domain.Operation) {
+	user := op.UserID
+	switch {
+	case op.UndoOf != 0:
+		var undone *domain.Operation
+		r.undo[user], undone = removeOperation(r.undo[user], op.UndoOf)
+		if undone != nil {
+			r.redo[user] = r.pushHistory(r.redo[user], undone)
+		}
+	case op.RedoOf != 0:
+		r.redo[user], _ = removeOperation(r.redo[user], op.RedoOf)
+		r.undo[user] = r.pushHistory(r.undo[user], op)
+	default:
+		r.undo[user] = r.pushHistory(r.undo[user], op)
+		delete(r.redo, user)
+	}
+}
+
+func (r *room) pushHistory(stack []*domain.Operation, op *domain.Operation) []*domain.Operation {
+	stack = append(stack, op)
+	if max := r.hub.config.MaxUndoDepth; max > 0 && len(stack) > max {
+		stack = stack[len(stack)-max:]
+	}
+	return stack
+}
+
+func removeOperation(stack []*domain.Operation, seq int64) ([]*domain.Operation, *domain.Operation) {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].Seq == seq {
+			op := stack[i]
+			return append(stack[:i], stack[i+1:]...), op
+		}
+	}
+	return stack, nil
+}
+
+// mutation applies a sequenced operation and relays it. Local operations are
+// also logged and acknowledged, or rejected if they do not apply.
+func (r *room) mutation(message []byte, rt route, local bool) {
+	var msg Message
+	if err := json.Unmarshal(message, &msg); err != nil {
+		log.Printf("Error unmarshaling operation: %v", err)
+		return
+	}
+
+	if local {
+		if objectID, err := board.ObjectID(msg.Data); err == nil && r.lockedByOther(objectID, rt.From) {
+			r.reject(rt.From, msg.OpID, NackLocked)
+			return
+		}
+	}
+
+	op, err := r.apply(&msg)
+	if err != nil {
+		if !local {
+			log.Printf("Error applying operation %d of %s: %v", msg.Seq, r.artboardID, err)
+			return
+		}
+		reason := NackInvalidOperation
+		if errors.Is(err, board.ErrObjectNotFound) {
+			reason = NackObjectNotFound
+		}
+		r.reject(rt.From, msg.OpID, reason)
+		return
+	}
+
+	r.broadcast(message, msg.Type, rt)
+	if !local {
+		return
+	}
+	r.persist(op)
+	r.countCheckpoint()
+	if sender, ok := r.byID[rt.From]; ok {
+		if ack, err := systemMessage("ack", r.artboardID, sender.userID, opResult{OpID: msg.OpID, Seq: msg.Seq}); err == nil {
+			r.sendTo(sender, ack, "ack")
+		}
+	}
+	r.relay(envelope{Kind: kindMessage, Type: msg.Type, Message: message, Route: rt})
+}
+
+// history serves an undo or redo request from a local client.
+func (r *room) history(message []byte, messageType string, rt route) {
+	sender, ok := r.byID[rt.From]
+	if !ok {
+		return
+	}
+	var req Message
+	if err := json.Unmarshal(message, &req); err != nil {
+		log.Printf("Error unmarshaling %s: %v", messageType, err)
+		return
+	}
+
+	msg := Message{ArtboardID: r.artboardID, UserID: sender.userID, From: sender.id, OpID: req.OpID, Seq: req.Seq}
+	if messageType == TypeUndo {
+		stack := r.undo[sender.userID]
+		if len(stack) == 0 {
+			r.reject(rt.From, req.OpID, NackNothingToUndo)
+			return
+		}
+		target := stack[len(stack)-1]
+		opType, data, err := board.Inverse(target.Type, target.Data, target.Prev)
+		if err != nil {
+			r.undo[sender.userID] = stack[:len(stack)-1]
+			r.reject(rt.From, req.OpID, NackConflict)
+			return
+		}
+		msg.Type, msg.Data, msg.UndoOf = opType, data, target.Seq
+	} else {
+		stack := r.redo[sender.userID]
+		if len(stack) == 0 {
+			r.reject(rt.From, req.OpID, NackNothingToRedo)
+			return
+		}
+		target := stack[len(stack)-1]
+		msg.Type, msg.Data, msg.RedoOf = target.Type, target.Data, target.Seq
+	}
+
+	if objectID, err := board.ObjectID(msg.Data); err == nil && r.lockedByOther(objectID, sender.id) {
+		r.reject(rt.From, req.OpID, NackLocked)
+		return
+	}
+
+	op, err := r.apply(&msg)
+	if err != nil {
+		// Someone else changed the object since; this step cannot be
+		// replayed, so drop it rather than blocking the stack forever.
+		if messageType == TypeUndo {
+			r.undo[sender.userID], _ = removeOperation(r.undo[sender.userID], msg.UndoOf)
+		} else {
+			r.redo[sender.userID], _ = removeOperation(r.redo[sender.userID], msg.RedoOf)
+		}
+		r.reject(rt.From, req.OpID, NackConflict)
+		return
+	}
+	r.persist(op)
+	r.countCheckpoint()
+
+	result, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling operation: %v", err)
+		return
+	}
+	rt = route{From: sender.id}
+	r.broadcast(result, msg.Type, rt)
+	if ack, err := systemMessage("ack", r.artboardID, sender.userID, opResult{OpID: msg.OpID, Seq: msg.Seq}); err == nil {
+		r.sendTo(sender, ack, "ack")
+	}
+	r.relay(envelope{Kind: kindMessage, Type: msg.Type, Message: result, Route: rt})
+}
+
+// reject sends a nack to a local sender.
+func (r *room) reject(connectionID, opID, reason string) {
+	sender, ok := r.byID[connectionID]
+	if !ok {
+		return
+	}
+	message, err := systemMessage("nack", r.artboardID, sender.userID, opResult{OpID: opID, Reason: reason})
+	if err != nil {
+		log.Printf("Error marshaling nack: %v", err)
+		return
+	}
+	r.sendTo(sender, message, "nack")
+}
+
+// sync sends a joining client the current document and who holds which
+// object.
+func (r *room) sync(client *Client) {
+	message, err := systemMessage("sync", r.artboardID, client.userID, map[string]interface{}{
+		"seq":     r.seq,
+		"objects": r.doc.Objects,
+		"locks":   r.heldLocks(false),
+	})
+	if err != nil {
+		log.Printf("Error marshaling sync: %v", err)
+		return
+	}
+	r.sendTo(client, message, "sync")
+}
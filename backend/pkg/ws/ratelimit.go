@@ -0,0 +1,156 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket: Rate messages per second on average, with
+// bursts of up to Burst. A zero Rate means unlimited.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Rate limit classes. Message types not listed in rateClasses count as
+// drawing operations.
+const (
+	RateClassCursor = "cursor"
+	RateClassOps    = "ops"
+	RateClassChat   = "chat"
+)
+
+var rateClasses = map[string]string{
+	"cursor": RateClassCursor,
+	"chat":   RateClassChat,
+}
+
+func rateClassOf(messageType string) string {
+	if class, ok := rateClasses[messageType]; ok {
+		return class
+	}
+	return RateClassOps
+}
+
+// Only violations within this sliding window count.
+const rateViolationWindow = time.Minute
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns nil for an unlimited RateLimit; a nil bucket
+// allows everything.
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: limit.Rate, burst: burst, tokens: burst}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	if !b.available(now) {
+		return false
+	}
+	b.take()
+	return true
+}
+
+// available refills the bucket and reports whether it holds a token.
+func (b *tokenBucket) available(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.refill(now)
+	return b.tokens >= 1
+}
+
+func (b *tokenBucket) take() {
+	if b != nil {
+		b.tokens--
+	}
+}
+
+// rateVerdict is what allowWith decided about a message.
+type rateVerdict int
+
+const (
+	rateAllowed rateVerdict = iota
+	// The sender exceeded its own limit.
+	rateLimitedClient
+	// The room as a whole is too busy; not the sender's fault.
+	rateLimitedRoom
+)
+
+// sharedBucket is a token bucket used from several goroutines, such as the
+// read pumps of every client in a room.
+type sharedBucket struct {
+	mutex  sync.Mutex
+	bucket *tokenBucket
+}
+
+// allowWith takes a token from both the client's bucket and the shared
+// bucket, or from neither, so a message one of them rejects costs the
+// other nothing. It reports which one rejected the message; the client's
+// own limit is checked first.
+func (s *sharedBucket) allowWith(client *tokenBucket, now time.Time) rateVerdict {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !client.available(now) {
+		return rateLimitedClient
+	}
+	if !s.bucket.available(now) {
+		return rateLimitedRoom
+	}
+	client.take()
+	s.bucket.take()
+	return rateAllowed
+}
+
+// clientLimiter holds the per-class buckets of one client. It is only used
+// from the client's readPump.
+type clientLimiter struct {
+	buckets map[string]*tokenBucket
+	// When each violation within the window happened, oldest first.
+	violations []time.Time
+}
+
+func newClientLimiter(limits map[string]RateLimit) *clientLimiter {
+	buckets := make(map[string]*tokenBucket, len(limits))
+	for class, limit := range limits {
+		buckets[class] = newTokenBucket(limit)
+	}
+	return &clientLimiter{buckets: buckets}
+}
+
+func (l *clientLimiter) bucket(messageType string) *tokenBucket {
+	return l.buckets[rateClassOf(messageType)]
+}
+
+// violation records a rejected message and returns how many happened
+// within the last rateViolationWindow.
+func (l *clientLimiter) violation(now time.Time) int {
+	expired := 0
+	for expired < len(l.violations) && now.Sub(l.violations[expired]) > rateViolationWindow {
+		expired++
+	}
+	l.violations = append(l.violations[expired:], now)
+	return len(l.violations)
+}
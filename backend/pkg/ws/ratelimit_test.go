@@ -0,0 +1,47 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllowWithReportsWhichBucketRejected(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		name         string
+		client, room RateLimit
+		want         []rateVerdict
+	}{
+		{"unlimited", RateLimit{}, RateLimit{}, []rateVerdict{rateAllowed, rateAllowed, rateAllowed}},
+		{"client limit", RateLimit{Rate: 1, Burst: 1}, RateLimit{}, []rateVerdict{rateAllowed, rateLimitedClient, rateLimitedClient}},
+		{"room limit", RateLimit{}, RateLimit{Rate: 1, Burst: 2}, []rateVerdict{rateAllowed, rateAllowed, rateLimitedRoom}},
+		// When both are out, the sender is the one at fault.
+		{"both", RateLimit{Rate: 1, Burst: 1}, RateLimit{Rate: 1, Burst: 1}, []rateVerdict{rateAllowed, rateLimitedClient}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newTokenBucket(tc.client)
+			room := &sharedBucket{bucket: newTokenBucket(tc.room)}
+			for i, want := range tc.want {
+				if got := room.allowWith(client, now); got != want {
+					t.Fatalf("message %d: got %d, want %d", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRoomRejectionCostsTheClientNothing(t *testing.T) {
+	now := time.Now()
+	client := newTokenBucket(RateLimit{Rate: 1, Burst: 1})
+	room := &sharedBucket{bucket: newTokenBucket(RateLimit{Rate: 1, Burst: 1})}
+	if got := room.allowWith(newTokenBucket(RateLimit{}), now); got != rateAllowed {
+		t.Fatalf("another client's message: got %d", got)
+	}
+	if got := room.allowWith(client, now); got != rateLimitedRoom {
+		t.Fatalf("got %d, want rateLimitedRoom", got)
+	}
+	room.bucket.tokens = 1
+	if got := room.allowWith(client, now); got != rateAllowed {
+		t.Fatalf("client's token was spent on a rejected message: got %d", got)
+	}
+}
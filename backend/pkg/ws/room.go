@@ -0,0 +1,352 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"goP2Pbackend/internal/domain"
+	"goP2Pbackend/pkg/board"
+
+	"github.com/gorilla/websocket"
+)
+
+// ephemeralTypes are message types that are superseded by the next message
+// of the same kind, so a slow client can miss some of them without ending
+// up out of sync.
+var ephemeralTypes = map[string]bool{
+	"cursor": true,
+}
+
+type roomEvent struct {
+	register   *Client
+	unregister *Client
+	remote     *envelope
+	// A message is delivered according to route unless target or user is
+	// set.
+	message     []byte
+	messageType string
+	route       route
+	target      *Client
+	// user delivers the message to the connections authenticated as user.
+	user string
+	// seqs are the sequence numbers reserved for the event by the room's
+	// sequencer, or seqErr why there are none (see seqRequest).
+	seqs   []int64
+	seqErr error
+	// patch changes the board on behalf of the server (see Hub.Patch).
+	patch *patchRequest
+	// kick disconnects a client with the given close code.
+	kick        *Client
+	closeCode   int
+	closeText   string
+	closeReason string
+}
+
+// room is the set of clients connected to one artboard. All of its state is
+// owned by the goroutine running run, so rooms never contend with each other.
+type room struct {
+	hub        *Hub
+	artboardID string
+	inbox      chan roomEvent
+	done       chan struct{}
+	clients    map[*Client]bool
+	byID       map[string]*Client
+	// Data channels reported by clients, see signaling.go.
+	links map[link]bool
+	// Everyone in the room across all instances, keyed by connection ID.
+	peers       map[string]Peer
+	unsubscribe func()
+	// Shared by the read pumps of every local client.
+	limiter *sharedBucket
+
+	// The board as of seq, and each user's undo/redo stacks (see ops.go).
+	doc   *board.Document
+	seq   int64
+	undo  map[string][]*domain.Operation
+	redo  map[string][]*domain.Operation
+	oplog chan *domain.Operation
+	// Local operations since the last checkpoint.
+	uncheckpointed int
+	// Object locks by object ID (see locks.go).
+	locks map[string]*objectLock
+	// Envelopes the room itself publishes, in order (see relay).
+	outbox chan envelope
+	// Local operations waiting for sequence numbers (see seqRequest).
+	sequencer chan seqRequest
+
+	// Clients that joined and have not left yet, and anything else holding
+	// the room (see Hub.acquire); guarded by hub.mutex.
+	members int
+}
+
+func newRoom(hub *Hub, artboardID string) *room {
+	return &room{
+		hub:        hub,
+		artboardID: artboardID,
+		inbox:      make(chan roomEvent, hub.config.RoomBufferSize),
+		done:       make(chan struct{}),
+		clients:    make(map[*Client]bool),
+		byID:       make(map[string]*Client),
+		links:      make(map[link]bool),
+		peers:      make(map[string]Peer),
+		limiter:    &sharedBucket{bucket: newTokenBucket(hub.config.RoomRateLimit)},
+		doc:        board.New(),
+		undo:       make(map[string][]*domain.Operation),
+		redo:       make(map[string][]*domain.Operation),
+		locks:      make(map[string]*objectLock),
+		outbox:     make(chan envelope, hub.config.RoomBufferSize),
+		sequencer:  make(chan seqRequest, hub.config.RoomBufferSize),
+	}
+}
+
+// post queues an event for the room. Once the room has stopped the event is
+// discarded instead of blocking the caller.
+func (r *room) post(event roomEvent) {
+	select {
+	case r.inbox <- event:
+	case <-r.done:
+	}
+}
+
+// deliver is the broker callback for this room.
+func (r *room) deliver(payload []byte) {
+	if payload == nil {
+		// Presence may have changed unseen; ask who is in the room.
+		r.hub.publish(r.artboardID, envelope{Kind: kindSyncRequest})
+		return
+	}
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		log.Printf("Error unmarshaling envelope: %v", err)
+		return
+	}
+	if env.Origin == r.hub.instanceID {
+		return
+	}
+	r.post(roomEvent{remote: &env})
+}
+
+func (r *room) run() {
+	r.load()
+	go r.publishOutbox()
+	go r.runSequencer()
+	defer close(r.outbox)
+	if r.hub.operations != nil {
+		r.oplog = make(chan *domain.Operation, r.hub.config.RoomBufferSize)
+		go r.writeOperations()
+		defer close(r.oplog)
+	}
+
+	expiry := time.NewTicker(r.hub.config.LockTimeout / 4)
+	defer expiry.Stop()
+	var checkpoints <-chan time.Time
+	if r.hub.config.CheckpointInterval > 0 {
+		ticker := time.NewTicker(r.hub.config.CheckpointInterval)
+		defer ticker.Stop()
+		checkpoints = ticker.C
+	}
+
+	for {
+		select {
+		case event := <-r.inbox:
+			r.handle(event)
+		case now := <-expiry.C:
+			r.expireLocks(now)
+		case <-checkpoints:
+			r.checkpoint()
+		case <-r.done:
+			// The last member left; finish whatever it queued before going.
+			for {
+				select {
+				case event := <-r.inbox:
+					r.handle(event)
+				default:
+					r.checkpoint()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *room) handle(event roomEvent) {
+	switch {
+	case event.register != nil:
+		r.clients[event.register] = true
+		r.byID[event.register.id] = event.register
+		r.peers[event.register.id] = event.register.peer()
+		r.welcome(event.register)
+		r.sync(event.register)
+		r.broadcastPresence()
+	case event.unregister != nil:
+		r.remove(event.unregister)
+		event.unregister.teardown(websocket.CloseNormalClosure, "")
+		r.broadcastPresence()
+	case event.remote != nil:
+		r.handleRemote(event.remote)
+	case event.kick != nil:
+		if r.clients[event.kick] {
+			r.disconnect(event.kick, event.closeReason, event.closeCode, event.closeText)
+		}
+	case event.target != nil:
+		r.sendTo(event.target, event.message, event.messageType)
+	case event.seqErr != nil:
+		r.unsequenced(event)
+	case event.patch != nil:
+		r.applyPatch(event.patch, event.seqs)
+	case event.user != "":
+		for client := range r.clients {
+			if client.userID == event.user {
+				r.sendTo(client, event.message, event.messageType)
+			}
+		}
+	case mutationTypes[event.messageType]:
+		r.mutation(event.message, event.route, true)
+	case event.messageType == TypeUndo || event.messageType == TypeRedo:
+		r.history(event.message, event.messageType, event.route)
+	case lockTypes[event.messageType]:
+		r.lockRequest(event.message, event.messageType, event.route)
+	default:
+		r.dispatch(event.message, event.messageType, event.route, true)
+	}
+}
+
+// relay publishes an envelope on behalf of the room. Publishing may loop
+// back into a room's inbox, so it never happens on the room goroutine
+// itself; a single publisher keeps the envelopes in order.
+func (r *room) relay(env envelope) {
+	r.outbox <- env
+}
+
+func (r *room) publishOutbox() {
+	for env := range r.outbox {
+		r.hub.publish(r.artboardID, env)
+	}
+}
+
+func (r *room) remove(client *Client) {
+	delete(r.clients, client)
+	delete(r.byID, client.id)
+	delete(r.peers, client.id)
+	r.dropLinks(client.id)
+	r.releaseLocks(client.id)
+}
+
+// dispatch delivers a client message to its recipients, or to the whole
+// room. local is set for messages from this instance's own clients.
+func (r *room) dispatch(message []byte, messageType string, rt route, local bool) {
+	if messageType == TypeRTCState {
+		r.trackLink(rt.From, message)
+	}
+	if len(rt.To) > 0 {
+		r.sendDirect(message, messageType, rt, local)
+		return
+	}
+	r.broadcast(message, messageType, rt)
+}
+
+func (r *room) handleRemote(env *envelope) {
+	switch env.Kind {
+	case kindMessage:
+		if mutationTypes[env.Type] {
+			r.mutation(env.Message, env.Route, false)
+			return
+		}
+		if lockTypes[env.Type] {
+			r.remoteLock(env.Message, env.Type)
+			return
+		}
+		r.dispatch(env.Message, env.Type, env.Route, false)
+	case kindJoin:
+		for _, peer := range env.Peers {
+			r.peers[peer.ConnectionID] = peer
+		}
+		r.broadcastPresence()
+	case kindLeave:
+		for _, peer := range env.Peers {
+			delete(r.peers, peer.ConnectionID)
+			r.dropLinks(peer.ConnectionID)
+			r.releaseLocks(peer.ConnectionID)
+		}
+		r.broadcastPresence()
+	case kindSyncRequest:
+		local := make([]Peer, 0, len(r.clients))
+		for client := range r.clients {
+			local = append(local, client.peer())
+		}
+		r.relay(envelope{Kind: kindMembers, Peers: local, Locks: r.heldLocks(true)})
+	case kindMembers:
+		for id, peer := range r.peers {
+			if peer.Instance == env.Origin {
+				delete(r.peers, id)
+			}
+		}
+		for _, peer := range env.Peers {
+			r.peers[peer.ConnectionID] = peer
+		}
+		for _, l := range env.Locks {
+			r.acceptLock(l)
+		}
+		r.broadcastPresence()
+	}
+}
+
+// broadcastPresence tells the local clients who is in the room.
+func (r *room) broadcastPresence() {
+	peers := make([]Peer, 0, len(r.peers))
+	for _, peer := range r.peers {
+		peers = append(peers, peer)
+	}
+	message, err := systemMessage("presence", r.artboardID, "", map[string]interface{}{"peers": peers})
+	if err != nil {
+		log.Printf("Error marshaling presence: %v", err)
+		return
+	}
+	r.broadcast(message, "presence", route{})
+}
+
+// broadcast queues message for every client in the room, skipping peers
+// that already got it over a data channel. A client whose buffer is full
+// misses ephemeral messages up to Config.MaxDroppedMessages in a row;
+// anything else it cannot keep up with gets it disconnected.
+func (r *room) broadcast(message []byte, messageType string, rt route) {
+	f := newFrame(message, messageType)
+	for client := range r.clients {
+		if rt.SkipSender && client.id == rt.From {
+			continue
+		}
+		if rt.P2P && r.links[newLink(rt.From, client.id)] {
+			continue
+		}
+		select {
+		case client.send <- f:
+			client.dropped = 0
+		default:
+			if ephemeralTypes[messageType] && client.dropped < r.hub.config.MaxDroppedMessages {
+				client.dropped++
+				r.hub.metrics.messageDropped()
+				continue
+			}
+			r.disconnect(client, CloseReasonSlowConsumer, websocket.CloseTryAgainLater, "slow consumer")
+		}
+	}
+}
+
+// sendTo queues message for a single client, if it is still connected.
+func (r *room) sendTo(client *Client, message []byte, messageType string) {
+	if !r.clients[client] {
+		return
+	}
+	select {
+	case client.send <- newFrame(message, messageType):
+	default:
+		r.disconnect(client, CloseReasonSlowConsumer, websocket.CloseTryAgainLater, "slow consumer")
+	}
+}
+
+func (r *room) disconnect(client *Client, reason string, code int, text string) {
+	r.remove(client)
+	client.closed(reason)
+	client.teardown(code, text)
+}
@@ -0,0 +1,74 @@
+package websocket
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// benchRoom starts a room with count clients whose write pumps are stood in
+// for by goroutines that encode each frame and mark it delivered on
+// delivered. Stopping it ends the room and the goroutines.
+func benchRoom(b *testing.B, count int, codec Codec, delivered *sync.WaitGroup) *room {
+	hub := NewHub(DefaultConfig(), NewMemoryBroker(), nil)
+	r := newRoom(hub, "board")
+	var consumers sync.WaitGroup
+	for i := 0; i < count; i++ {
+		client := &Client{hub: hub, room: r, send: make(chan *frame, 1), codec: codec, id: fmt.Sprintf("client-%d", i), artboardID: "board"}
+		r.clients[client] = true
+		r.byID[client.id] = client
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for f := range client.send {
+				if _, err := f.encode(client.codec); err != nil {
+					b.Error(err)
+				}
+				delivered.Done()
+			}
+		}()
+	}
+	go r.run()
+	b.Cleanup(func() {
+		close(r.done)
+		for client := range r.clients {
+			close(client.send)
+		}
+		consumers.Wait()
+	})
+	return r
+}
+
+// BenchmarkRoomBroadcast posts messages to a running room of thousands of
+// clients and reports how long each takes to reach all of them, encoded as
+// their write pumps would. MessagePack clients share a single encoding of
+// each frame.
+func BenchmarkRoomBroadcast(b *testing.B) {
+	message := []byte(`{"type":"cursor","artboard_id":"board","user_id":"alice","from":"client-0","data":{"x":120.5,"y":88.25}}`)
+	for _, codec := range []Codec{jsonCodec{}, msgpackCodec{}} {
+		for _, count := range []int{1000, 5000, 10000} {
+			b.Run(fmt.Sprintf("%s/clients=%d", codec.Subprotocol(), count), func(b *testing.B) {
+				var delivered sync.WaitGroup
+				r := benchRoom(b, count, codec, &delivered)
+				latencies := make([]time.Duration, 0, b.N)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					start := time.Now()
+					delivered.Add(count)
+					r.post(roomEvent{message: message, messageType: "cursor"})
+					delivered.Wait()
+					latencies = append(latencies, time.Since(start))
+				}
+				b.StopTimer()
+
+				sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+				b.ReportMetric(float64(latencies[len(latencies)/2].Microseconds()), "p50-us/msg")
+				b.ReportMetric(float64(latencies[len(latencies)*99/100].Microseconds()), "p99-us/msg")
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*count), "ns/client")
+			})
+		}
+	}
+}
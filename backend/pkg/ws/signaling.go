@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// WebRTC signaling message types.
+// Offers, answers and ICE candidates go only to the peer named in "to" (see direct.go), never to the room.
+// Once a data channel is up, or has failed, the client reports it with rtc_state,
+// so the server knows which pairs it no longer has to relay for.
+const (
+	TypeRTCOffer     = "rtc_offer"
+	TypeRTCAnswer    = "rtc_answer"
+	TypeRTCCandidate = "rtc_ice"
+	TypeRTCState     = "rtc_state"
+)
+
+var signalingTypes = map[string]bool{
+	TypeRTCOffer:     true,
+	TypeRTCAnswer:    true,
+	TypeRTCCandidate: true,
+}
+
+// link is an established data channel between two connections.
+type link struct {
+	a, b string
+}
+
+func newLink(x, y string) link {
+	if x > y {
+		x, y = y, x
+	}
+	return link{a: x, b: y}
+}
+
+type rtcState struct {
+	Peer      string `json:"peer"`
+	Connected bool   `json:"connected"`
+}
+
+// trackLink records the data channel state reported in an rtc_state message.
+func (r *room) trackLink(from string, message []byte) {
+	var msg Message
+	if err := json.Unmarshal(message, &msg); err != nil {
+		log.Printf("Error unmarshaling rtc_state: %v", err)
+		return
+	}
+	var state rtcState
+	if err := json.Unmarshal(msg.Data, &state); err != nil || state.Peer == "" {
+		return
+	}
+
+	if state.Connected {
+		r.links[newLink(from, state.Peer)] = true
+	} else {
+		delete(r.links, newLink(from, state.Peer))
+	}
+}
+
+// dropLinks forgets every data channel of a connection that left.
+func (r *room) dropLinks(connectionID string) {
+	for l := range r.links {
+		if l.a == connectionID || l.b == connectionID {
+			delete(r.links, l)
+		}
+	}
+}
+
+// welcome tells a new client its peer ID and the ICE servers to use.
+func (r *room) welcome(client *Client) {
+	message, err := systemMessage("welcome", r.artboardID, client.userID, map[string]interface{}{
+		"connection_id": client.id,
+		"ice_servers":   r.hub.config.ICEServers,
+	})
+	if err != nil {
+		log.Printf("Error marshaling welcome: %v", err)
+		return
+	}
+	r.sendTo(client, message, "welcome")
+}
@@ -0,0 +1,153 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// Every user with a connection on this instance is subscribed to a broker
+// topic of their own, so server-side events such as mentions reach all of
+// their connections, on any instance and in any room.
+func userTopic(userID string) string {
+	return "user:" + userID
+}
+
+type userSubscription struct {
+	connections int
+	unsubscribe func()
+}
+
+// EditPolicy decides whether a user may change an artboard. Users who may
+// not still receive everything and can chat, but their mutations, undo/redo
+// and lock requests are nacked with NackForbidden. An error refuses the
+// connection: domain.ErrForbidden for users without any access.
+type EditPolicy func(artboardID, userID string) (bool, error)
+
+// SetEditPolicy installs policy. It must be called before the hub starts
+// serving connections; without one everybody may edit.
+func (h *Hub) SetEditPolicy(policy EditPolicy) {
+	h.editPolicy = policy
+}
+
+func (h *Hub) canEdit(artboardID, userID string) (bool, error) {
+	if h.editPolicy == nil {
+		return true, nil
+	}
+	return h.editPolicy(artboardID, userID)
+}
+
+// subscribeUser counts a new local connection of userID, which must be the
+// identity the connection authenticated as: whoever holds the subscription
+// receives everything sent to the user.
+func (h *Hub) subscribeUser(userID string) {
+	if userID == "" {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if sub, ok := h.users[userID]; ok {
+		sub.connections++
+		return
+	}
+	unsubscribe, err := h.broker.Subscribe(userTopic(userID), func(payload []byte) {
+		h.deliverToUser(userID, payload)
+	})
+	if err != nil {
+		log.Printf("Error subscribing to user %s: %v", userID, err)
+		return
+	}
+	h.users[userID] = &userSubscription{connections: 1, unsubscribe: unsubscribe}
+}
+
+// IsOnline reports whether userID has a connection on this instance.
+func (h *Hub) IsOnline(userID string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	_, ok := h.users[userID]
+	return ok
+}
+
+// OnlineUsers returns the users with a connection on this instance.
+func (h *Hub) OnlineUsers() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	users := make([]string, 0, len(h.users))
+	for userID := range h.users {
+		users = append(users, userID)
+	}
+	return users
+}
+
+// InstanceID identifies this hub among the instances sharing its broker.
+func (h *Hub) InstanceID() string {
+	return h.instanceID
+}
+
+// unsubscribeUser forgets a local connection of userID.
+func (h *Hub) unsubscribeUser(userID string) {
+	h.mutex.Lock()
+	sub, ok := h.users[userID]
+	if ok {
+		sub.connections--
+		if sub.connections > 0 {
+			ok = false
+		} else {
+			delete(h.users, userID)
+		}
+	}
+	h.mutex.Unlock()
+
+	if ok {
+		sub.unsubscribe()
+	}
+}
+
+// deliverToUser hands a message published on a user topic to every local
+// room, which passes it on to the connections authenticated as that user.
+// Unlike addressed messages, it never matches connection IDs.
+func (h *Hub) deliverToUser(userID string, payload []byte) {
+	if payload == nil {
+		return
+	}
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		log.Printf("Error unmarshaling envelope: %v", err)
+		return
+	}
+
+	h.mutex.Lock()
+	rooms := make([]*room, 0, len(h.rooms))
+	for _, r := range h.rooms {
+		rooms = append(rooms, r)
+	}
+	h.mutex.Unlock()
+
+	for _, r := range rooms {
+		r.post(roomEvent{message: env.Message, messageType: env.Type, user: userID})
+	}
+}
+
+// SendToUser delivers a server-built message to every connection of
+// userID, whichever artboard it is open on.
+func (h *Hub) SendToUser(userID string, msg *Message) error {
+	message, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", msg.Type, err)
+	}
+	payload, err := json.Marshal(envelope{Origin: h.instanceID, Kind: kindMessage, Type: msg.Type, Message: message})
+	if err != nil {
+		return fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+	return h.broker.Publish(userTopic(userID), payload)
+}
+
+// Notify pushes a notification of the given kind to userID's connections.
+func (h *Hub) Notify(userID, kind string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	return h.SendToUser(userID, &Message{Type: kind, UserID: userID, Data: raw})
+}